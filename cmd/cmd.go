@@ -4,7 +4,10 @@ import (
 	"github.com/goat-project/exporter/service"
 
 	"github.com/goat-project/exporter/constants"
+	"github.com/goat-project/exporter/gauge"
 	"github.com/goat-project/exporter/logger"
+	"github.com/goat-project/exporter/parse"
+	"github.com/goat-project/exporter/watch"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,7 +16,10 @@ import (
 const version = "1.0.0"
 
 var flags = []string{constants.CfgGoatEndpoint, constants.CfgDirectoryPath, constants.CfgPrometheusEndpoint,
-	constants.CfgDebug, constants.CfgLogPath} // all flags are required except log-path
+	constants.CfgDebug, constants.CfgLogPath, constants.CfgQuarantinePath} // all flags are required except optional
+
+// optionalFlags is the number of optional flags at the end of flags (log-path, quarantine-path)
+const optionalFlags = 2
 
 var cmd = &cobra.Command{
 	Use:   "exporter",
@@ -25,6 +31,7 @@ var cmd = &cobra.Command{
 		logger.Init()
 
 		checkRequired()
+		checkOptions()
 		if viper.GetBool("debug") {
 			logrus.WithFields(logrus.Fields{"version": version}).Debug("service version")
 			logFlags()
@@ -56,9 +63,32 @@ func Initialize() {
 	cmd.PersistentFlags().StringP(constants.CfgDebug, "d", viper.GetString(constants.CfgDebug),
 		"debug")
 	cmd.PersistentFlags().String(constants.CfgLogPath, viper.GetString(constants.CfgLogPath), "path to log file")
+	cmd.PersistentFlags().String(constants.CfgQuarantinePath, viper.GetString(constants.CfgQuarantinePath),
+		"path to directory for files which cannot be processed")
+
+	quarantineCmd.AddCommand(quarantineListCmd, quarantineReplayCmd)
+	cmd.AddCommand(quarantineCmd)
 
 	bindFlags(*cmd)
 
+	viper.SetDefault(constants.CfgPush, false)
+	viper.SetDefault(constants.CfgPushToken, "")
+	viper.SetDefault(constants.CfgBackfill, true)
+	viper.SetDefault(constants.CfgBackfillOrder, "mtime")
+	viper.SetDefault(constants.CfgBackfillMaxAge, 0)
+	viper.SetDefault(constants.CfgWatchMode, watch.ModeInotify)
+	viper.SetDefault(constants.CfgPollInterval, watch.DefaultPollInterval)
+	viper.SetDefault(constants.CfgSettleInterval, "2s")
+	viper.SetDefault(constants.CfgLedgerPath, "")
+	viper.SetDefault(constants.CfgBatchSize, parse.DefaultBatchSize)
+	viper.SetDefault(constants.CfgValidationMode, parse.ModeLenient)
+	viper.SetDefault(constants.CfgValidationReject, parse.RejectFile)
+	viper.SetDefault(constants.CfgQuarantineMove, false)
+	viper.SetDefault(constants.CfgJanitorInterval, "1m")
+	viper.SetDefault(constants.CfgMetricNames, gauge.NamingBoth)
+	viper.SetDefault(constants.CfgGoCollector, true)
+	viper.SetDefault(constants.CfgProcessCollector, true)
+
 	viper.SetDefault("author", "Lenka Svetlovska")
 	viper.SetDefault("license", "apache")
 }
@@ -80,13 +110,24 @@ func initConfig() {
 }
 
 func checkRequired() {
-	for _, req := range flags[:len(flags)-1] { // required flags without the last one (log-path)
+	for _, req := range flags[:len(flags)-optionalFlags] { // required flags without the optional ones
+		if req == constants.CfgDirectoryPath && viper.IsSet(constants.CfgRoots) {
+			continue // roots are watched instead of directory path
+		}
+
 		if viper.GetString(req) == "" {
 			logrus.WithFields(logrus.Fields{"flag": req}).Fatal("required flag not set")
 		}
 	}
 }
 
+// checkOptions checks values of options which cannot be fixed while running.
+func checkOptions() {
+	if err := watch.ValidateOrder(viper.GetString(constants.CfgBackfillOrder)); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Fatal("invalid option")
+	}
+}
+
 func bindFlags(command cobra.Command) {
 	for _, flag := range flags {
 		err := viper.BindPFlag(flag, command.PersistentFlags().Lookup(flag))
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/goat-project/exporter/constants"
+	"github.com/goat-project/exporter/logger"
+	"github.com/goat-project/exporter/quarantine"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "manages files which could not be processed",
+	Long: "Files of unknown type or files which could not be parsed are put to quarantine-path " +
+		"together with a JSON file describing the error.",
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists quarantined files",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Init()
+
+		entries, err := openQuarantine().List()
+		if err != nil {
+			logrus.WithField("error", err).Fatal("error list quarantine")
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTIME\tTYPE\tSOURCE\tERROR")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Name, e.Time.Format("2006-01-02 15:04:05"), e.Type,
+				e.Source, e.Error)
+		}
+
+		if err = w.Flush(); err != nil {
+			logrus.WithField("error", err).Error("error write quarantine list")
+		}
+	},
+}
+
+var quarantineReplayCmd = &cobra.Command{
+	Use:   "replay [NAME]...",
+	Short: "replays quarantined files",
+	Long: "Quarantined files are written back to their source paths, so the running exporter processes them " +
+		"again. All quarantined files are replayed when no name is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Init()
+
+		q := openQuarantine()
+
+		names := args
+		if len(names) == 0 {
+			entries, err := q.List()
+			if err != nil {
+				logrus.WithField("error", err).Fatal("error list quarantine")
+			}
+
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+		}
+
+		for _, name := range names {
+			entry, err := q.Replay(name)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"error": err, "name": name}).Error("error replay file")
+				continue
+			}
+
+			logrus.WithFields(logrus.Fields{"name": name, "file": entry.Source}).Info("file replayed")
+		}
+	},
+}
+
+func openQuarantine() quarantine.Quarantine {
+	path := viper.GetString(constants.CfgQuarantinePath)
+	if path == "" {
+		logrus.WithField("flag", constants.CfgQuarantinePath).Fatal("required flag not set")
+	}
+
+	return quarantine.Quarantine{Path: path}
+}
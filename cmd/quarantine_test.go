@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goat-project/exporter/constants"
+	"github.com/goat-project/exporter/quarantine"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cmd Suite")
+}
+
+var _ = Describe("Quarantine commands tests", func() {
+	var (
+		dir     string
+		sources []string
+		q       quarantine.Quarantine
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "quarantine-cmd-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		q = quarantine.Quarantine{Path: filepath.Join(dir, "quarantine"), Move: true}
+		viper.Set(constants.CfgQuarantinePath, q.Path)
+
+		sources = []string{filepath.Join(dir, "vms.apel"), filepath.Join(dir, "ips.json")}
+		for _, source := range sources {
+			Expect(ioutil.WriteFile(source, []byte(filepath.Base(source)), 0600)).To(Succeed())
+			_, err = q.Put(source, "vm", errors.New("unknown file type"))
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		viper.Set(constants.CfgQuarantinePath, "")
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("listing quarantined files", func() {
+		It("should print every quarantined file", func() {
+			var out bytes.Buffer
+			quarantineListCmd.SetOut(&out)
+			defer quarantineListCmd.SetOut(nil)
+
+			quarantineListCmd.Run(quarantineListCmd, nil)
+
+			lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+			Expect(lines).To(HaveLen(3))
+			Expect(string(lines[0])).To(MatchRegexp(`^NAME\s+TIME\s+TYPE\s+SOURCE\s+ERROR$`))
+			Expect(string(lines[1])).To(ContainSubstring(sources[0]))
+			Expect(string(lines[2])).To(ContainSubstring(sources[1]))
+			Expect(string(lines[2])).To(ContainSubstring("unknown file type"))
+		})
+	})
+
+	Describe("replaying quarantined files", func() {
+		Context("when names are given", func() {
+			It("should replay only the named files", func() {
+				entries, err := q.List()
+				Expect(err).NotTo(HaveOccurred())
+
+				quarantineReplayCmd.Run(quarantineReplayCmd, []string{entries[1].Name})
+
+				Expect(sources[0]).NotTo(BeAnExistingFile())
+				Expect(ioutil.ReadFile(sources[1])).To(Equal([]byte("ips.json")))
+				Expect(q.List()).To(ConsistOf(entries[0]))
+			})
+		})
+
+		Context("when no name is given", func() {
+			It("should replay all files", func() {
+				quarantineReplayCmd.Run(quarantineReplayCmd, nil)
+
+				for _, source := range sources {
+					Expect(ioutil.ReadFile(source)).To(Equal([]byte(filepath.Base(source))))
+				}
+				Expect(q.List()).To(BeEmpty())
+			})
+		})
+	})
+})
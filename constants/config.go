@@ -4,12 +4,60 @@ package constants
 const (
 	// CfgGoatEndpoint represents string (address:port) of goat server endpoint
 	CfgGoatEndpoint = "goat-endpoint"
+	// CfgPush represents true for accepting records pushed to Prometheus endpoint; false otherwise
+	CfgPush = "push"
+	// CfgPushToken represents bearer token required by push endpoint, empty means no authentication
+	CfgPushToken = "push-token"
 	// CfgDirectoryPath represents path to directory with files generated by Goat
 	CfgDirectoryPath = "dir-path"
+	// CfgRoots represents list of watched root directories with their file patterns, format and labels,
+	// directory path is watched when no roots are set
+	CfgRoots = "roots"
 	// CfgPrometheusEndpoint represents string (address:port) of Prometheus endpoint
 	CfgPrometheusEndpoint = "prometheus-endpoint"
 	// CfgDebug represents true for debug mode; false otherwise
 	CfgDebug = "debug"
 	// CfgLogPath represents path to log file
 	CfgLogPath = "log-path"
+	// CfgBackfill represents true for parsing files already present in directory path on startup; false otherwise
+	CfgBackfill = "backfill"
+	// CfgBackfillOrder represents order of files parsed on startup (mtime/name)
+	CfgBackfillOrder = "backfill-order"
+	// CfgBackfillMaxAge represents maximal age of files parsed on startup, 0 means no limit
+	CfgBackfillMaxAge = "backfill-max-age"
+	// CfgWatchMode represents how files in directory path are watched (inotify/poll/hybrid)
+	CfgWatchMode = "watch-mode"
+	// CfgPollInterval represents period of scans of directory path in poll and hybrid watch modes
+	CfgPollInterval = "poll-interval"
+	// CfgSettleInterval represents time without write after which a file is parsed, 0 means parse on every write
+	CfgSettleInterval = "settle-interval"
+	// CfgTTL represents time per kind of records (ttl.vm, ttl.ip, ttl.st) after which gauges not refreshed
+	// by any record are deleted, 0 means never
+	CfgTTL = "ttl"
+	// CfgJanitorInterval represents how often expired gauges are deleted
+	CfgJanitorInterval = "janitor-interval"
+	// CfgQuarantinePath represents path to directory for files which cannot be processed, empty means no quarantine
+	CfgQuarantinePath = "quarantine-path"
+	// CfgQuarantineMove represents true for moving files to quarantine; false for copying
+	CfgQuarantineMove = "quarantine-move"
+	// CfgDetectPatterns represents list of file name patterns with their record format
+	CfgDetectPatterns = "detect-patterns"
+	// CfgBatchSize represents maximal number of records exported at once
+	CfgBatchSize = "batch-size"
+	// CfgValidationMode represents validation of records (lenient/warn/strict)
+	CfgValidationMode = "validation-mode"
+	// CfgValidationReject represents what is rejected in strict validation mode (file/record)
+	CfgValidationReject = "validation-reject"
+	// CfgGoCollector represents true for exporting Go runtime metrics; false otherwise
+	CfgGoCollector = "go-collector"
+	// CfgProcessCollector represents true for exporting process metrics; false otherwise
+	CfgProcessCollector = "process-collector"
+	// CfgMetricNames represents naming scheme of exported gauges (goat/legacy/both)
+	CfgMetricNames = "metric-names"
+	// CfgGaugeLabels represents record fields exported as labels per kind of records and metric, and relabel rules
+	CfgGaugeLabels = "gauge-labels"
+	// CfgRollups represents list of totals of record values grouped by record fields
+	CfgRollups = "rollups"
+	// CfgLedgerPath represents path to file with processed files, empty means no ledger
+	CfgLedgerPath = "ledger-path"
 )
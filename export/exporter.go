@@ -2,39 +2,53 @@ package export
 
 import (
 	"github.com/goat-project/exporter/gauge"
+	"github.com/goat-project/exporter/metrics"
 	"github.com/goat-project/exporter/record"
 	"github.com/sirupsen/logrus"
 )
 
 // Exporter receives records in record channel and exports them using a given gauge.
+// Records are added to rollups too, when they are set. Exported records are counted by Metrics.
 type Exporter struct {
 	RecordChan chan record.Record
 	Gauge      *gauge.Gauge
+	Rollups    *Rollups
+	Metrics    *metrics.Metrics
 }
 
-// CreateExporter creates exported with record channel and gauges.
+// CreateExporter creates exported with record channel, gauges and new metrics.
 func CreateExporter(recordChan chan record.Record, gauge *gauge.Gauge) *Exporter {
 	return &Exporter{
 		RecordChan: recordChan,
 		Gauge:      gauge,
+		Metrics:    metrics.New(),
 	}
 }
 
-// Export exports records based on their type.
+// Export exports records based on their kind.
 func (e Exporter) Export(finished chan bool) {
 	for records := range e.RecordChan {
-		switch records.(type) {
-		case record.IPs:
-			e.Gauge.IPGauge.Export(records)
-		case record.Storages:
-			e.Gauge.StorageGauge.Export(records)
-		case record.VMs:
-			e.Gauge.VMGauge.Export(records)
-		default:
-			logrus.Error("unable to export, unknown record type")
+		if r, ok := records.(record.Retired); ok {
+			e.Gauge.RetireAll(r.Source)
+			e.Rollups.Retire(r.Source)
+			continue
 		}
+
+		if !e.Gauge.Export(records) {
+			logrus.WithField("kind", records.Kind()).Error("unable to export, unknown record type")
+			continue
+		}
+		e.Rollups.Export(records)
+
+		e.exported(records.Kind(), records.Len())
 	}
 
 	logrus.Info("export finished")
 	finished <- true
 }
+
+// exported updates self-instrumentation metrics after records of a given kind were exported.
+func (e Exporter) exported(kind string, count int) {
+	e.Metrics.RecordsExported.WithLabelValues(kind).Add(float64(count))
+	e.Metrics.LastExport.WithLabelValues(kind).SetToCurrentTime()
+}
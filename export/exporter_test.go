@@ -0,0 +1,65 @@
+package export
+
+import (
+	"time"
+
+	"github.com/goat-project/exporter/gauge"
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter tests", func() {
+	var (
+		exporter *Exporter
+		finished chan bool
+	)
+
+	BeforeEach(func() {
+		gauges := gauge.CreateAll(prometheus.NewRegistry(), metrics.New())
+		gauges.RegistryAll()
+
+		exporter = CreateExporter(make(chan record.Record), gauges)
+		finished = make(chan bool, 1)
+
+		go exporter.Export(finished)
+	})
+
+	AfterEach(func() {
+		close(exporter.RecordChan)
+		Eventually(finished).Should(Receive())
+	})
+
+	Describe("exporting records", func() {
+		Context("when records are exported", func() {
+			It("should count them and set time of the last export", func() {
+				start := time.Now().Unix()
+
+				exporter.RecordChan <- record.IPs{Ips: []record.IP{{SiteName: "a"}, {SiteName: "b"}},
+					Source: "records"}
+
+				Eventually(func() float64 {
+					return testutil.ToFloat64(exporter.Metrics.RecordsExported.WithLabelValues(record.KindIP))
+				}).Should(Equal(2.0))
+				Eventually(func() float64 {
+					return testutil.ToFloat64(exporter.Metrics.LastExport.WithLabelValues(record.KindIP))
+				}).Should(BeNumerically(">=", start))
+			})
+		})
+
+		Context("when records are retired", func() {
+			It("should not count them", func() {
+				exporter.RecordChan <- record.Retired{Source: "records"}
+				exporter.RecordChan <- record.Retired{Source: "records"} // the first one was taken
+
+				Expect(testutil.ToFloat64(exporter.Metrics.RecordsExported.WithLabelValues(record.KindRetired))).To(
+					BeZero())
+			})
+		})
+	})
+})
@@ -0,0 +1,378 @@
+package export
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goat-project/exporter/gauge"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// RollupConfig configures a rollup - the total of a numeric field of records of one kind grouped by fields
+// of the records (dimensions). It is exported as goat_rollup_<name> with dimensions as labels in snake case.
+type RollupConfig struct {
+	Name  string   `mapstructure:"name"`
+	Kind  string   `mapstructure:"kind"`
+	Field string   `mapstructure:"field"`
+	By    []string `mapstructure:"by"`
+}
+
+// rollupName matches valid names of rollups.
+var rollupName = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// Rollups maintains totals of record values grouped by dimensions, so dashboards can query low-cardinality
+// totals instead of aggregating series of all records. Like gauges, the latest record of every virtual machine,
+// IP user and storage contributes to the totals, and records are deleted when their files are removed
+// or when they expire. Static labels of the source of records are attached to the totals like to gauges,
+// so records from different roots are summed separately.
+type Rollups struct {
+	mutex   sync.Mutex
+	rollups []*rollup
+	static  gauge.StaticLabels
+}
+
+// rollup maintains totals of one configured rollup.
+type rollup struct {
+	RollupConfig
+	keyed   gauge.Keyed
+	desc    *prometheus.Desc
+	entries map[string]*contribution // record key -> contribution
+	groups  map[string]*group        // joined dimensions -> total
+}
+
+// contribution is a value of one record added to the total of its group, a record without the value
+// is kept to be compared with later records but it is added to no group.
+type contribution struct {
+	record  interface{}
+	group   string
+	value   float64
+	counted bool
+	sources map[string]struct{}
+	updated time.Time
+}
+
+// group is a total of records with the same dimensions.
+type group struct {
+	labelValues []string
+	total       float64
+	records     int
+}
+
+// NewRollups checks configuration of rollups and creates them with given static labels. Records of a kind
+// are totalled when the gauges of the kind are keyed, they are identified by the keys of the gauges.
+func NewRollups(configs []RollupConfig, gauges *gauge.Gauge, static gauge.StaticLabels) (*Rollups, error) {
+	r := &Rollups{static: static}
+
+	for _, cfg := range configs {
+		keyed, ok := gauges.Keyed(cfg.Kind)
+		if !ok {
+			return nil, fmt.Errorf("rollup %s: unknown kind: %s", cfg.Name, cfg.Kind)
+		}
+		t := keyed.RecordType()
+
+		if !rollupName.MatchString(cfg.Name) {
+			return nil, fmt.Errorf("rollup %s: invalid name", cfg.Name)
+		}
+
+		field, ok := t.FieldByName(cfg.Field)
+		if !ok {
+			return nil, fmt.Errorf("rollup %s: unknown field of %s record: %s", cfg.Name, cfg.Kind, cfg.Field)
+		}
+		if !numeric(field.Type) {
+			return nil, fmt.Errorf("rollup %s: field %s is not numeric", cfg.Name, cfg.Field)
+		}
+
+		labels := make([]string, len(cfg.By))
+		for i, field := range cfg.By {
+			if _, ok := t.FieldByName(field); !ok {
+				return nil, fmt.Errorf("rollup %s: unknown field of %s record: %s", cfg.Name, cfg.Kind, field)
+			}
+			labels[i] = gauge.SnakeCase(field)
+		}
+
+		for _, name := range static.Names {
+			for _, label := range labels {
+				if label == name {
+					return nil, fmt.Errorf("rollup %s: static label %s has the name of a dimension", cfg.Name, name)
+				}
+			}
+		}
+		labels = append(labels, static.Names...)
+
+		r.rollups = append(r.rollups, &rollup{
+			RollupConfig: cfg,
+			keyed:        keyed,
+			desc: prometheus.NewDesc(prometheus.BuildFQName("goat", "rollup", cfg.Name),
+				fmt.Sprintf("represents the total of %s of %s records by %s.", cfg.Field, cfg.Kind,
+					strings.Join(cfg.By, ", ")), labels, nil),
+			entries: make(map[string]*contribution),
+			groups:  make(map[string]*group),
+		})
+	}
+
+	return r, nil
+}
+
+// Export adds values of records to totals, the previous value of the same record is replaced.
+// Nil rollups ignore records.
+func (r *Rollups) Export(rec record.Record) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	for _, ro := range r.rollups {
+		if ro.Kind != rec.Kind() {
+			continue
+		}
+
+		entries, source := ro.keyed.Entries(rec)
+		static := r.staticValues(source)
+		for _, e := range entries {
+			ro.put(source, e.Key, e.Record, static, now)
+		}
+	}
+}
+
+// Retire deletes values of records which come only from a given source file.
+func (r *Rollups) Retire(source string) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, ro := range r.rollups {
+		for key, c := range ro.entries {
+			if _, ok := c.sources[source]; !ok {
+				continue
+			}
+
+			delete(c.sources, source)
+			if len(c.sources) == 0 {
+				ro.remove(key)
+			}
+		}
+	}
+}
+
+// Expire deletes values of records not refreshed for longer than their TTL.
+func (r *Rollups) Expire(ttl gauge.TTL) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, ro := range r.rollups {
+		if ttl[ro.Kind] <= 0 {
+			continue
+		}
+
+		deadline := time.Now().Add(-ttl[ro.Kind])
+		for key, c := range ro.entries {
+			if c.updated.Before(deadline) {
+				ro.remove(key)
+			}
+		}
+	}
+}
+
+// Janitor deletes expired values periodically.
+func (r *Rollups) Janitor(interval time.Duration, ttl gauge.TTL) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.Expire(ttl)
+	}
+}
+
+// Describe sends descriptions of all rollups.
+func (r *Rollups) Describe(ch chan<- *prometheus.Desc) {
+	for _, ro := range r.rollups {
+		ch <- ro.desc
+	}
+}
+
+// Collect sends totals of all groups of all rollups.
+func (r *Rollups) Collect(ch chan<- prometheus.Metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, ro := range r.rollups {
+		for _, g := range ro.groups {
+			m, err := prometheus.NewConstMetric(ro.desc, prometheus.GaugeValue, g.total, g.labelValues...)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"error": err, "rollup": ro.Name}).Error("error render rollup")
+				continue
+			}
+
+			ch <- m
+		}
+	}
+}
+
+// staticValues returns values of static labels of a given source in order of their names.
+func (r *Rollups) staticValues(source string) []string {
+	if len(r.static.Names) == 0 {
+		return nil
+	}
+
+	var labels map[string]string
+	if r.static.Values != nil {
+		labels = r.static.Values(source)
+	}
+
+	values := make([]string, len(r.static.Names))
+	for i, name := range r.static.Names {
+		values[i] = labels[name]
+	}
+
+	return values
+}
+
+// put replaces the contribution of a record with a given key, the record is grouped by its dimensions and values
+// of static labels. A stale record (e.g. from an older file processed again) only adds its source to the previous
+// record, like in gauges. Records without the value contribute nothing.
+func (ro *rollup) put(source, key string, rec interface{}, static []string, now time.Time) {
+	sources := map[string]struct{}{}
+	if previous, ok := ro.entries[key]; ok {
+		if ro.keyed.Stale(rec, previous.record) {
+			previous.sources[source] = struct{}{}
+			previous.updated = now
+			return
+		}
+
+		sources = previous.sources
+		ro.remove(key)
+	}
+	sources[source] = struct{}{}
+
+	c := &contribution{record: rec, sources: sources, updated: now}
+	ro.entries[key] = c
+
+	v := reflect.ValueOf(rec)
+	value, ok := number(v.FieldByName(ro.Field))
+	if !ok {
+		return
+	}
+
+	labelValues := make([]string, len(ro.By), len(ro.By)+len(static))
+	for i, field := range ro.By {
+		labelValues[i] = text(v.FieldByName(field))
+	}
+	labelValues = append(labelValues, static...)
+	groupKey := strings.Join(labelValues, "\xff")
+
+	g, ok := ro.groups[groupKey]
+	if !ok {
+		g = &group{labelValues: labelValues}
+		ro.groups[groupKey] = g
+	}
+	g.total += value
+	g.records++
+
+	c.group, c.value, c.counted = groupKey, value, true
+}
+
+// remove subtracts the contribution of a record with a given key, groups without records are deleted.
+func (ro *rollup) remove(key string) {
+	c, ok := ro.entries[key]
+	if !ok {
+		return
+	}
+	delete(ro.entries, key)
+
+	if !c.counted {
+		return
+	}
+
+	g := ro.groups[c.group]
+	g.total -= c.value
+	g.records--
+	if g.records == 0 {
+		delete(ro.groups, c.group)
+	}
+}
+
+// number returns value of a numeric field, durations in seconds and times in seconds since epoch.
+// It returns false if an optional field is not set or a string field is not a number.
+func number(v reflect.Value) (float64, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+
+	switch t := v.Interface().(type) {
+	case time.Duration:
+		return t.Seconds(), true
+	case time.Time:
+		return float64(t.Unix()), true
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// numeric checks whether a field of a given type can hold a number, durations are integers.
+func numeric(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+
+	return t == reflect.TypeOf(time.Time{})
+}
+
+// text returns value of a field as a label value, empty string if an optional field is not set.
+func text(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,330 @@
+package export
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/goat-project/exporter/gauge"
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Export Suite")
+}
+
+var _ = Describe("Rollup tests", func() {
+	var (
+		registry *prometheus.Registry
+		rollups  *Rollups
+	)
+
+	user := "goat-user"
+	other := "other-user"
+
+	gauges := gauge.CreateAll(prometheus.NewRegistry(), metrics.New())
+
+	vm := func(uuid, site string, user *string, cpu time.Duration) record.VM {
+		return record.VM{VMUUID: uuid, SiteName: site, GlobalUserName: user, CPUDuration: &cpu}
+	}
+
+	BeforeEach(func() {
+		var err error
+		rollups, err = NewRollups([]RollupConfig{{
+			Name:  "vm_cpu_duration_seconds",
+			Kind:  record.KindVM,
+			Field: "CPUDuration",
+			By:    []string{"SiteName", "GlobalUserName"},
+		}}, gauges, gauge.StaticLabels{})
+		Expect(err).NotTo(HaveOccurred())
+
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(rollups)
+	})
+
+	Describe("exporting records", func() {
+		Context("when records of more users are exported", func() {
+			It("should sum values per site and user", func() {
+				rollups.Export(record.VMs{VMs: []record.VM{
+					vm("1", "site", &user, time.Hour),
+					vm("2", "site", &user, 2*time.Hour),
+					vm("3", "site", &other, time.Minute),
+				}, Source: "records"})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{
+					"site;goat-user":  3 * 3600,
+					"site;other-user": 60,
+				}))
+			})
+		})
+
+		Context("when record of the same VMUUID is exported again", func() {
+			It("should replace its value", func() {
+				rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &user, time.Hour)}, Source: "old"})
+				rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &user, 2*time.Hour)}, Source: "new"})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;goat-user": 2 * 3600}))
+			})
+		})
+
+		Context("when older record of the same VMUUID is exported again", func() {
+			It("should keep the value of the newer record", func() {
+				newer, older := vm("1", "site", &user, 2*time.Hour), vm("1", "site", &user, time.Hour)
+				end := time.Now()
+				newer.EndTime = &end
+				start := end.Add(-time.Hour)
+				older.EndTime = &start
+
+				rollups.Export(record.VMs{VMs: []record.VM{newer}, Source: "new"})
+				rollups.Export(record.VMs{VMs: []record.VM{older}, Source: "old"})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;goat-user": 2 * 3600}))
+
+				rollups.Retire("new")
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;goat-user": 2 * 3600}))
+			})
+		})
+
+		Context("when record moves to another group", func() {
+			It("should delete the empty group", func() {
+				rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &user, time.Hour)}, Source: "old"})
+				rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &other, time.Hour)}, Source: "new"})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;other-user": 3600}))
+			})
+		})
+
+		Context("when IPv4 and IPv6 records of the same user are exported", func() {
+			It("should sum both", func() {
+				ipRollups, err := NewRollups([]RollupConfig{{
+					Name:  "ip_addresses",
+					Kind:  record.KindIP,
+					Field: "IPCount",
+					By:    []string{"SiteName", "GlobalUserName"},
+				}}, gauges, gauge.StaticLabels{})
+				Expect(err).NotTo(HaveOccurred())
+
+				registry = prometheus.NewRegistry()
+				registry.MustRegister(ipRollups)
+
+				ipRollups.Export(record.IPs{Ips: []record.IP{
+					{SiteName: "site", GlobalUserName: user, IPVersion: 4, IPCount: 2},
+					{SiteName: "site", GlobalUserName: user, IPVersion: 6, IPCount: 3},
+				}, Source: "records"})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;goat-user": 5}))
+			})
+		})
+
+		Context("when records of other kind are exported", func() {
+			It("should ignore them", func() {
+				rollups.Export(record.IPs{Ips: []record.IP{{SiteName: "site", IPCount: 2}}, Source: "records"})
+
+				Expect(totals(registry)).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("deleting records", func() {
+		BeforeEach(func() {
+			rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &user, time.Hour)}, Source: "old"})
+			rollups.Export(record.VMs{VMs: []record.VM{vm("2", "site", &user, time.Hour)}, Source: "new"})
+		})
+
+		Context("when source of records is retired", func() {
+			It("should subtract only records from the source", func() {
+				rollups.Retire("old")
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;goat-user": 3600}))
+			})
+		})
+
+		Context("when records are expired", func() {
+			It("should delete their groups", func() {
+				rollups.Expire(gauge.TTL{record.KindVM: time.Nanosecond})
+
+				Expect(totals(registry)).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("configuring rollups", func() {
+		Context("when configuration is invalid", func() {
+			It("should return an error", func() {
+				for _, cfg := range []RollupConfig{
+					{Name: "total", Kind: "unknown", Field: "CPUDuration"},
+					{Name: "total", Kind: record.KindRetired, Field: "Source"},
+					{Name: "total-cpu", Kind: record.KindVM, Field: "CPUDuration"},
+					{Name: "total", Kind: record.KindVM, Field: "Unknown"},
+					{Name: "total", Kind: record.KindVM, Field: "CPUDuration", By: []string{"Unknown"}},
+				} {
+					_, err := NewRollups([]RollupConfig{cfg}, gauges, gauge.StaticLabels{})
+					Expect(err).To(HaveOccurred())
+				}
+			})
+		})
+
+		Context("when static label has the name of a dimension", func() {
+			It("should return an error", func() {
+				_, err := NewRollups([]RollupConfig{{Name: "total", Kind: record.KindVM, Field: "CPUDuration",
+					By: []string{"SiteName"}}}, gauges, gauge.StaticLabels{Names: []string{"site_name"}})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("rolling up records of added kind", func() {
+		Context("when gauges of the kind are keyed", func() {
+			It("should sum values of the latest records", func() {
+				custom := gauge.CreateAll(prometheus.NewRegistry(), metrics.New())
+				custom.Add("session", sessionGauge{})
+
+				sessionRollups, err := NewRollups([]RollupConfig{{
+					Name:  "sessions",
+					Kind:  "session",
+					Field: "Count",
+					By:    []string{"SiteName"},
+				}}, custom, gauge.StaticLabels{})
+				Expect(err).NotTo(HaveOccurred())
+
+				registry = prometheus.NewRegistry()
+				registry.MustRegister(sessionRollups)
+
+				sessionRollups.Export(sessions{{ID: "1", SiteName: "site", Count: 2}, {ID: "2", SiteName: "site", Count: 3}})
+				sessionRollups.Export(sessions{{ID: "1", SiteName: "site", Count: 1}})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;": 4}))
+			})
+		})
+	})
+
+	Describe("attaching static labels", func() {
+		BeforeEach(func() {
+			var err error
+			rollups, err = NewRollups([]RollupConfig{{
+				Name:  "vm_cpu_duration_seconds",
+				Kind:  record.KindVM,
+				Field: "CPUDuration",
+				By:    []string{"SiteName", "GlobalUserName"},
+			}}, gauges, gauge.StaticLabels{Names: []string{"instance"}, Values: func(source string) map[string]string {
+				switch filepath.Dir(source) {
+				case "site-a":
+					return map[string]string{"instance": "site-a"}
+				case "site-b":
+					return map[string]string{"instance": "site-b"}
+				}
+				return nil
+			}})
+			Expect(err).NotTo(HaveOccurred())
+
+			registry = prometheus.NewRegistry()
+			registry.MustRegister(rollups)
+		})
+
+		Context("when records of the same dimensions come from more roots", func() {
+			It("should sum them per root", func() {
+				rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &user, time.Hour)}, Source: "site-a/vms"})
+				rollups.Export(record.VMs{VMs: []record.VM{vm("2", "site", &user, 2*time.Hour)},
+					Source: "site-b/vms"})
+				rollups.Export(record.VMs{VMs: []record.VM{vm("3", "site", &user, time.Minute)}, Source: "pushed"})
+
+				Expect(totals(registry)).To(Equal(map[string]float64{
+					"site;goat-user;site-a": 3600,
+					"site;goat-user;site-b": 2 * 3600,
+					"site;goat-user;":       60,
+				}))
+			})
+		})
+
+		Context("when source of records of one root is retired", func() {
+			It("should keep totals of other roots", func() {
+				rollups.Export(record.VMs{VMs: []record.VM{vm("1", "site", &user, time.Hour)}, Source: "site-a/vms"})
+				rollups.Export(record.VMs{VMs: []record.VM{vm("2", "site", &user, 2*time.Hour)},
+					Source: "site-b/vms"})
+				rollups.Retire("site-a/vms")
+
+				Expect(totals(registry)).To(Equal(map[string]float64{"site;goat-user;site-b": 2 * 3600}))
+			})
+		})
+	})
+})
+
+// totals returns values of gathered rollups by their label values joined by ";", the instance label is the last one
+// when it is attached.
+func totals(registry *prometheus.Registry) map[string]float64 {
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			key := labels["site_name"] + ";" + labels["global_user_name"]
+			if instance, ok := labels["instance"]; ok {
+				key += ";" + instance
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+
+	return values
+}
+
+// session is a record of a kind added to gauges.
+type session struct {
+	ID       string
+	SiteName string
+	Count    int
+}
+
+// sessions are records of a kind added to gauges.
+type sessions []session
+
+func (s sessions) Kind() string {
+	return "session"
+}
+
+func (s sessions) Len() int {
+	return len(s)
+}
+
+// sessionGauge is a keyed exporter of sessions which exports no gauges.
+type sessionGauge struct{}
+
+func (sessionGauge) Register(prometheus.Registerer) {}
+
+func (sessionGauge) Export(record.Record) {}
+
+func (sessionGauge) Retire(string) {}
+
+func (sessionGauge) Expire(time.Duration) int {
+	return 0
+}
+
+func (sessionGauge) RecordType() reflect.Type {
+	return reflect.TypeOf(session{})
+}
+
+func (sessionGauge) Stale(rec, previous interface{}) bool {
+	return false
+}
+
+func (sessionGauge) Entries(rec record.Record) ([]gauge.Entry, string) {
+	var entries []gauge.Entry
+	for _, s := range rec.(sessions) {
+		entries = append(entries, gauge.Entry{Key: s.ID, Record: s})
+	}
+
+	return entries, "sessions"
+}
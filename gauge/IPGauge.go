@@ -1,115 +1,123 @@
 package gauge
 
 import (
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/goat-project/exporter/record"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/sirupsen/logrus"
+)
+
+var (
+	ipTimestampLabels = []string{
+		"SiteName",
+		"CloudComputeService",
+		"CloudType",
+		"LocalUser",
+		"LocalGroup",
+		"GlobalUserName",
+		"FQAN",
+		"IPVersion",
+	}
+
+	// ipLegacyLabels are labels of legacy names, records of both IP versions of a user share their series.
+	ipLegacyLabels = []string{
+		"SiteName",
+		"LocalUser",
+		"LocalGroup",
+		"GlobalUserName",
+	}
+
+	ipLabels = append(append([]string(nil), ipLegacyLabels...), "IPVersion")
 )
 
 // IPGauge represents IP gauges exported to Prometheus.
+// The latest record of every user and IP version is stored and gauges are rendered from it at scrape time.
 type IPGauge struct {
-	Timestamp       *prometheus.GaugeVec
-	MeasurementTime *prometheus.GaugeVec
-	IPCount         *prometheus.GaugeVec
+	*collector
 }
 
 // NewIPGauge create new IP gauge.
 func NewIPGauge() *IPGauge {
-	ipg := IPGauge{}
-
-	ipg.Timestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "ip",
-		Name:      "Timestamp",
-		Help:      "represents time when the measurements were exported to the Prometheus.",
-	},
-		[]string{
-			"SiteName",
-			"CloudComputeService",
-			"CloudType",
-			"LocalUser",
-			"LocalGroup",
-			"GlobalUserName",
-			"FQAN",
-			"IPVersion",
-		},
-	)
-
-	ipg.MeasurementTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "ip",
-		Name:      "MeasurementTime",
-		Help:      "represents time when the measurements were recorded.",
-	},
-		[]string{
-			"SiteName",
-			"LocalUser",
-			"LocalGroup",
-			"GlobalUserName",
-		},
-	)
-
-	ipg.IPCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "ip",
-		Name:      "IPCount",
-		Help:      "represents the number of IPs owned by a given user.",
-	},
-		[]string{
-			"SiteName",
-			"LocalUser",
-			"LocalGroup",
-			"GlobalUserName",
-		},
-	)
-
-	return &ipg
+	return &IPGauge{collector: newCollector(record.KindIP, record.IP{}, ipFields, []metric{
+		ipMetric("Timestamp", "goat_ip_timestamp_seconds",
+			"represents time when the measurements were exported to the Prometheus.",
+			ipTimestampLabels, func(ip record.IP, updated time.Time) (float64, bool) {
+				return float64(updated.Unix()), true
+			}),
+		legacyLabeled(ipLegacyLabels, ipMetric("MeasurementTime", "goat_ip_measurement_time_seconds",
+			"represents time when the measurements were recorded.",
+			ipLabels, func(ip record.IP, _ time.Time) (float64, bool) {
+				return float64(ip.MeasurementTime), true
+			})),
+		legacyLabeled(ipLegacyLabels, ipMetric("IPCount", "goat_ip_addresses",
+			"represents the number of IPs owned by a given user.",
+			ipLabels, func(ip record.IP, _ time.Time) (float64, bool) {
+				return float64(ip.IPCount), true
+			})),
+	})}
 }
 
-// Register registers IP gauge.
-func (ipg *IPGauge) Register() {
-	gauges := []prometheus.Collector{
-		ipg.Timestamp,
-		ipg.MeasurementTime,
-		ipg.IPCount,
+// Export stores IP records, the previous record of the same user and IP version is replaced.
+func (ipg *IPGauge) Export(rec record.Record) {
+	entries, source := ipg.Entries(rec)
+	for _, e := range entries {
+		ipg.store.put(source, e.Key, e.Record)
 	}
+}
 
-	prometheus.MustRegister(gauges...)
+// RecordType returns the type of IP records.
+func (ipg *IPGauge) RecordType() reflect.Type {
+	return reflect.TypeOf(record.IP{})
+}
 
-	logrus.WithField("resource", "ip").Debug("gauges registered")
+// Stale returns false, IP records are never stale, the latest processed record of a user is exported.
+func (ipg *IPGauge) Stale(rec, previous interface{}) bool {
+	return false
 }
 
-// Export exports IP gauges to Prometheus.
-func (ipg *IPGauge) Export(rec record.Record) {
+// Entries returns IP records keyed by user and IP version.
+func (ipg *IPGauge) Entries(rec record.Record) ([]Entry, string) {
 	ips := rec.(record.IPs)
 
-	for _, ip := range ips.Ips {
-		label := prometheus.Labels{
-			"SiteName":       ip.SiteName,
-			"LocalUser":      ip.LocalUser,
-			"LocalGroup":     ip.LocalGroup,
-			"GlobalUserName": ip.GlobalUserName,
-		}
-
-		labelTimestamp := prometheus.Labels{
-			"SiteName":            ip.SiteName,
-			"CloudType":           ip.CloudType,
-			"LocalUser":           ip.LocalUser,
-			"LocalGroup":          ip.LocalGroup,
-			"GlobalUserName":      ip.GlobalUserName,
-			"FQAN":                ip.FQAN,
-			"IPVersion":           string(ip.IPVersion),
-			"CloudComputeService": "",
-		}
-
-		if ip.CloudComputeService != nil {
-			labelTimestamp["CloudComputeService"] = *ip.CloudComputeService
-		}
-
-		ipg.Timestamp.With(labelTimestamp).Set(float64(time.Now().Unix()))
-
-		ipg.MeasurementTime.With(label).Set(float64(ip.MeasurementTime))
-
-		ipg.IPCount.With(label).Set(float64(ip.IPCount))
+	entries := make([]Entry, len(ips.Ips))
+	for i, ip := range ips.Ips {
+		entries[i] = Entry{Key: strings.Join([]string{ip.SiteName, ip.LocalUser, ip.LocalGroup, ip.GlobalUserName,
+			strconv.Itoa(int(ip.IPVersion))}, "\xff"), Record: ip}
+	}
+
+	return entries, ips.Source
+}
+
+// ipMetric creates gauge rendered from IP records.
+func ipMetric(name, goat, help string, labels []string,
+	value func(ip record.IP, updated time.Time) (float64, bool)) metric {
+	return metric{
+		name:   name,
+		goat:   goat,
+		help:   help,
+		labels: labels,
+		value: func(rec interface{}, updated time.Time) (float64, bool) {
+			return value(rec.(record.IP), updated)
+		},
+	}
+}
+
+// ipFields returns fields of IP record which can be exported as labels.
+func ipFields(rec interface{}) prometheus.Labels {
+	ip := rec.(record.IP)
+
+	return prometheus.Labels{
+		"SiteName":            ip.SiteName,
+		"CloudComputeService": optional(ip.CloudComputeService),
+		"CloudType":           ip.CloudType,
+		"LocalUser":           ip.LocalUser,
+		"LocalGroup":          ip.LocalGroup,
+		"GlobalUserName":      ip.GlobalUserName,
+		"FQAN":                ip.FQAN,
+		"IPVersion":           strconv.Itoa(int(ip.IPVersion)),
 	}
 }
@@ -1,287 +1,153 @@
 package gauge
 
 import (
+	"reflect"
 	"time"
 
-	"github.com/goat-project/exporter/utils"
-
 	"github.com/goat-project/exporter/record"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/sirupsen/logrus"
+)
+
+var (
+	storageTimestampLabels = []string{
+		"RecordId",
+		"StorageSystem",
+		"Site",
+		"StorageShare",
+		"StorageMedia",
+		"StorageClass",
+		"DirectoryPath",
+		"LocalUser",
+		"LocalGroup",
+		"UserIdentity",
+		"Group",
+		"GroupAttribute",
+		"GroupAttributeType",
+	}
+
+	storageLabels = []string{
+		"RecordId",
+		"Site",
+		"LocalUser",
+		"LocalGroup",
+		"UserIdentity",
+	}
 )
 
 // StorageGauge represents storage gauges exported to Prometheus.
+// The latest record of every RecordID is stored and gauges are rendered from it at scrape time.
 type StorageGauge struct {
-	Timestamp                 *prometheus.GaugeVec
-	CreateTime                *prometheus.GaugeVec
-	FileCount                 *prometheus.GaugeVec
-	StartTime                 *prometheus.GaugeVec
-	EndTime                   *prometheus.GaugeVec
-	ResourceCapacityUsed      *prometheus.GaugeVec
-	LogicalCapacityUsed       *prometheus.GaugeVec
-	ResourceCapacityAllocated *prometheus.GaugeVec
+	*collector
 }
 
 // NewStorageGauge creates storage gauge.
 func NewStorageGauge() *StorageGauge {
-	stg := StorageGauge{}
-
-	stg.Timestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "Timestamp",
-		Help:      "represents time when the measurements were exported to the Prometheus.",
-	},
-		[]string{
-			"RecordId",
-			"StorageSystem",
-			"Site",
-			"StorageShare",
-			"StorageMedia",
-			"StorageClass",
-			"DirectoryPath",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-			"Group",
-			"GroupAttribute",
-			"GroupAttributeType",
-		},
-	)
-
-	stg.FileCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "FileCount",
-		Help:      "represents the number of files.",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	stg.ResourceCapacityUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "ResourceCapacityUsed",
-		Help:      "represents the amount of resource capacity used.",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	stg.LogicalCapacityUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "LogicalCapacityUsed",
-		Help:      "represents the amount of logical capacity used.",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	stg.ResourceCapacityAllocated = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "ResourceCapacityAllocated",
-		Help:      "represents the amount of resource capacity allocated.",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	stg.CreateTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "CreateTime",
-		Help:      "represents the time when the measurements were recorded.",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	stg.StartTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "StartTime",
-		Help:      "represents the time when the given storage was created/registered.",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	stg.EndTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "st",
-		Name:      "EndTime",
-		Help:      "represents the time when the given storage was finished (or recorded).",
-	},
-		[]string{
-			"RecordId",
-			"Site",
-			"LocalUser",
-			"LocalGroup",
-			"UserIdentity",
-		},
-	)
-
-	return &stg
+	return &StorageGauge{collector: newCollector(record.KindStorage, record.Storage{}, storageFields, []metric{
+		storageMetric("Timestamp", "goat_storage_timestamp_seconds",
+			"represents time when the measurements were exported to the Prometheus.",
+			storageTimestampLabels, func(storage record.Storage, updated time.Time) (float64, bool) {
+				return float64(updated.Unix()), true
+			}),
+		storageMetric("FileCount", "goat_storage_files",
+			"represents the number of files.",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return uint64Value(storage.FileCount)
+			}),
+		storageMetric("ResourceCapacityUsed", "goat_storage_resource_capacity_used_bytes",
+			"represents the amount of resource capacity used.",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return float64(storage.ResourceCapacityUsed), true
+			}),
+		storageMetric("LogicalCapacityUsed", "goat_storage_logical_capacity_used_bytes",
+			"represents the amount of logical capacity used.",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return uint64Value(storage.LogicalCapacityUsed)
+			}),
+		storageMetric("ResourceCapacityAllocated", "goat_storage_resource_capacity_allocated_bytes",
+			"represents the amount of resource capacity allocated.",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return uint64Value(storage.ResourceCapacityAllocated)
+			}),
+		storageMetric("CreateTime", "goat_storage_create_time_seconds",
+			"represents the time when the measurements were recorded.",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return float64(storage.CreateTime.Unix()), true
+			}),
+		storageMetric("StartTime", "goat_storage_start_time_seconds",
+			"represents the time when the given storage was created/registered.",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return float64(storage.StartTime.Unix()), true
+			}),
+		storageMetric("EndTime", "goat_storage_end_time_seconds",
+			"represents the time when the given storage was finished (or recorded).",
+			storageLabels, func(storage record.Storage, _ time.Time) (float64, bool) {
+				return float64(storage.EndTime.Unix()), true
+			}),
+	})}
 }
 
-// Register registers storage gauge.
-func (stg *StorageGauge) Register() {
-	gauges := []prometheus.Collector{
-		stg.Timestamp,
-		stg.CreateTime,
-		stg.FileCount,
-		stg.StartTime,
-		stg.EndTime,
-		stg.ResourceCapacityUsed,
-		stg.LogicalCapacityUsed,
-		stg.ResourceCapacityAllocated,
+// Export stores storage records, the previous record with the same RecordID is replaced.
+func (stg *StorageGauge) Export(rec record.Record) {
+	entries, source := stg.Entries(rec)
+	for _, e := range entries {
+		stg.store.put(source, e.Key, e.Record)
 	}
+}
 
-	prometheus.MustRegister(gauges...)
+// RecordType returns the type of storage records.
+func (stg *StorageGauge) RecordType() reflect.Type {
+	return reflect.TypeOf(record.Storage{})
+}
 
-	logrus.WithField("resource", "st").Debug("gauges registered")
+// Stale returns false, storage records are never stale, the latest processed record is exported.
+func (stg *StorageGauge) Stale(rec, previous interface{}) bool {
+	return false
 }
 
-// Export exports storage gauges to Prometheus.
-func (stg *StorageGauge) Export(rec record.Record) {
+// Entries returns storage records keyed by RecordID.
+func (stg *StorageGauge) Entries(rec record.Record) ([]Entry, string) {
 	storages := rec.(record.Storages)
 
-	for _, storage := range storages.Storages {
-		label := prometheus.Labels{
-			"RecordId":     storage.RecordID,
-			"Site":         "",
-			"LocalUser":    "",
-			"LocalGroup":   "",
-			"UserIdentity": "",
-		}
-
-		if storage.Site != nil {
-			label["Site"] = *storage.Site
-		}
-
-		if storage.LocalUser != nil {
-			label["LocalUser"] = *storage.LocalUser
-		}
-
-		if storage.LocalGroup != nil {
-			label["LocalGroup"] = *storage.LocalGroup
-		}
-
-		if storage.UserIdentity != nil {
-			label["UserIdentity"] = *storage.UserIdentity
-		}
-
-		stg.Timestamp.With(labelForStorageTimestamp(storage)).Set(float64(time.Now().Unix()))
-
-		stg.CreateTime.With(label).Set(float64(storage.CreateTime.Unix()))
-
-		if storage.FileCount != nil {
-			stg.FileCount.With(label).Set(utils.StrToF64(*storage.FileCount))
-		}
-
-		stg.StartTime.With(label).Set(float64(storage.StartTime.Unix()))
-
-		stg.EndTime.With(label).Set(float64(storage.EndTime.Unix()))
-
-		stg.ResourceCapacityUsed.With(label).Set(float64(storage.ResourceCapacityUsed))
-
-		if storage.LogicalCapacityUsed != nil {
-			stg.LogicalCapacityUsed.With(label).Set(float64(*storage.LogicalCapacityUsed))
-		}
+	entries := make([]Entry, len(storages.Storages))
+	for i, storage := range storages.Storages {
+		entries[i] = Entry{Key: storage.RecordID, Record: storage}
+	}
 
-		if storage.ResourceCapacityAllocated != nil {
-			stg.ResourceCapacityAllocated.With(label).Set(float64(*storage.ResourceCapacityAllocated))
-		}
+	return entries, storages.Source
+}
 
+// storageMetric creates gauge rendered from storage records.
+func storageMetric(name, goat, help string, labels []string,
+	value func(storage record.Storage, updated time.Time) (float64, bool)) metric {
+	return metric{
+		name:   name,
+		goat:   goat,
+		help:   help,
+		labels: labels,
+		value: func(rec interface{}, updated time.Time) (float64, bool) {
+			return value(rec.(record.Storage), updated)
+		},
 	}
 }
 
-func labelForStorageTimestamp(storage record.Storage) prometheus.Labels {
-	labels := prometheus.Labels{
+// storageFields returns fields of storage record which can be exported as labels.
+func storageFields(rec interface{}) prometheus.Labels {
+	storage := rec.(record.Storage)
+
+	return prometheus.Labels{
 		"RecordId":           storage.RecordID,
 		"StorageSystem":      storage.StorageSystem,
-		"Site":               "",
-		"StorageShare":       "",
-		"StorageMedia":       "",
-		"StorageClass":       "",
-		"DirectoryPath":      "",
-		"LocalUser":          "",
-		"LocalGroup":         "",
-		"UserIdentity":       "",
-		"Group":              "",
-		"GroupAttribute":     "",
-		"GroupAttributeType": "",
-	}
-
-	if storage.Site != nil {
-		labels["Site"] = *storage.Site
-	}
-
-	if storage.StorageShare != nil {
-		labels["StorageShare"] = *storage.StorageShare
-	}
-
-	if storage.StorageMedia != nil {
-		labels["StorageMedia"] = *storage.StorageMedia
-	}
-
-	if storage.StorageClass != nil {
-		labels["StorageClass"] = *storage.StorageClass
-	}
-
-	if storage.DirectoryPath != nil {
-		labels["DirectoryPath"] = *storage.DirectoryPath
-	}
-
-	if storage.LocalUser != nil {
-		labels["LocalUser"] = *storage.LocalUser
-	}
-
-	if storage.LocalGroup != nil {
-		labels["LocalGroup"] = *storage.LocalGroup
-	}
-
-	if storage.UserIdentity != nil {
-		labels["UserIdentity"] = *storage.UserIdentity
-	}
-
-	if storage.Group != nil {
-		labels["Group"] = *storage.Group
-	}
-
-	if storage.GroupAttribute != nil {
-		labels["GroupAttribute"] = *storage.GroupAttribute
-	}
-
-	if storage.GroupAttributeType != nil {
-		labels["GroupAttributeType"] = *storage.GroupAttributeType
+		"Site":               optional(storage.Site),
+		"StorageShare":       optional(storage.StorageShare),
+		"StorageMedia":       optional(storage.StorageMedia),
+		"StorageClass":       optional(storage.StorageClass),
+		"DirectoryPath":      optional(storage.DirectoryPath),
+		"LocalUser":          optional(storage.LocalUser),
+		"LocalGroup":         optional(storage.LocalGroup),
+		"UserIdentity":       optional(storage.UserIdentity),
+		"Group":              optional(storage.Group),
+		"GroupAttribute":     optional(storage.GroupAttribute),
+		"GroupAttributeType": optional(storage.GroupAttributeType),
 	}
-
-	return labels
 }
@@ -2,382 +2,325 @@ package gauge
 
 import (
 	"fmt"
+	"reflect"
 	"time"
 
-	"github.com/goat-project/exporter/utils"
-
 	"github.com/goat-project/exporter/record"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/sirupsen/logrus"
+)
+
+var (
+	vmTimestampLabels = []string{
+		"VMUUID",
+		"SiteName",
+		"CloudComputeService",
+		"MachineName",
+		"LocalUserID",
+		"LocalGroupID",
+		"GlobalUserName",
+		"FQAN",
+		"Status",
+		"Benchmark",
+		"BenchmarkType",
+		"StorageRecordId",
+		"ImageId",
+		"CloudType",
+	}
+
+	vmLabels = []string{
+		"VMUUID",
+		"SiteName",
+		"LocalUserID",
+		"LocalGroupID",
+		"GlobalUserName",
+	}
+
+	vmNetworkLabels     = append(append([]string(nil), vmLabels...), "NetworkType")
+	vmAcceleratorLabels = append(append([]string(nil), vmLabels...), "AcceleratorType")
 )
 
 // VMGauge represents virtual machine/server gauges exported to Prometheus.
+// The latest record of every VMUUID is stored and gauges are rendered from it at scrape time.
 type VMGauge struct {
-	Timestamp       *prometheus.GaugeVec
-	StartTime       *prometheus.GaugeVec
-	EndTime         *prometheus.GaugeVec
-	SuspendDuration *prometheus.GaugeVec
-	WallDuration    *prometheus.GaugeVec
-	CPUDuration     *prometheus.GaugeVec
-	CPUCount        *prometheus.GaugeVec
-	NetworkInbound  *prometheus.GaugeVec
-	NetworkOutbound *prometheus.GaugeVec
-	PublicIPCount   *prometheus.GaugeVec
-	Memory          *prometheus.GaugeVec
-	Disk            *prometheus.GaugeVec
+	*collector
 }
 
 // NewVMGauge creates new vm/server gauge.
 func NewVMGauge() *VMGauge {
-	vmg := VMGauge{}
-
-	vmg.Timestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "Timestamp",
-		Help:      "represents time when the measurements were exported to the Prometheus.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"CloudComputeService",
-			"MachineName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-			"FQAN",
-			"Status",
-			"Benchmark",
-			"BenchmarkType",
-			"StorageRecordId",
-			"ImageId",
-			"CloudType",
-		},
-	)
-
-	vmg.StartTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "StartTime",
-		Help:      "represents the time when the given virtual machine/server was started.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
-
-	vmg.EndTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "EndTime",
-		Help:      "represents the time when the given virtual machine/server was finished (or recorded).",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
+	return &VMGauge{collector: newCollector(record.KindVM, vmRecord{}, vmFields, []metric{
+		vmMetric("Timestamp", "goat_vm_timestamp_seconds",
+			"represents time when the measurements were exported to the Prometheus.",
+			vmTimestampLabels, func(vm vmRecord, updated time.Time) (float64, bool) {
+				return float64(updated.Unix()), true
+			}),
+		vmMetric("StartTime", "goat_vm_start_time_seconds",
+			"represents the time when the given virtual machine/server was started in seconds since epoch.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return unixTime(vm.StartTime)
+			}),
+		vmMetric("EndTime", "goat_vm_end_time_seconds",
+			"represents the time when the given virtual machine/server was finished (or recorded) "+
+				"in seconds since epoch.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return unixTime(vm.EndTime)
+			}),
+		vmMetric("SuspendDuration", "goat_vm_suspend_duration_seconds",
+			"represents the time when the given virtual machine/server was suspended. "+
+				"The value is counted as END_TIME - START_TIME - WALL_DURATION in seconds.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return seconds(vm.SuspendDuration)
+			}),
+		vmMetric("WallDuration", "goat_vm_wall_duration_seconds",
+			"represents the time when the given virtual machine/server was running in seconds.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return seconds(vm.WallDuration)
+			}),
+		vmMetric("CPUDuration", "goat_vm_cpu_duration_seconds",
+			"represents the time when the given CPU was running in seconds. Same as WallDuration.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return seconds(vm.CPUDuration)
+			}),
+		vmMetric("CPUCount", "goat_vm_cpus",
+			"represents the number of CPUs.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return float64(vm.CPUCount), true
+			}),
+		vmMetric("NetworkInbound", "goat_vm_network_inbound_bytes",
+			"represents network inbound.",
+			vmNetworkLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return uint64Value(vm.NetworkInbound)
+			}),
+		vmMetric("NetworkOutbound", "goat_vm_network_outbound_bytes",
+			"represents network outbound.",
+			vmNetworkLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return uint64Value(vm.NetworkOutbound)
+			}),
+		vmMetric("PublicIPCount", "goat_vm_public_ips",
+			"represents the number of used public IPs.",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return uint64Value(vm.PublicIPCount)
+			}),
+		scaled(mebibyte, vmMetric("Memory", "goat_vm_memory_bytes",
+			"represents the size of memory (in MiB with legacy names).",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return uint64Value(vm.Memory)
+			})),
+		scaled(mebibyte, vmMetric("Disk", "goat_vm_disk_bytes",
+			"represents the size of disks (in MiB with legacy names).",
+			vmLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return uint64Value(vm.Disk)
+			})),
+		vmMetric("AcceleratorCount", "goat_vm_accelerators",
+			"represents the number of accelerators (GPUs, FPGAs, ...). Available since APEL v0.5.",
+			vmAcceleratorLabels, func(vm vmRecord, _ time.Time) (float64, bool) {
+				return uint64Value(vm.AcceleratorCount)
+			}),
+		vmCounter("goat_vm_network_inbound_bytes_total",
+			"represents network inbound accumulated from successive records of the given virtual machine/server.",
+			vmNetworkLabels, func(vm vmRecord) counter {
+				return vm.networkInbound
+			}),
+		vmCounter("goat_vm_network_outbound_bytes_total",
+			"represents network outbound accumulated from successive records of the given virtual machine/server.",
+			vmNetworkLabels, func(vm vmRecord) counter {
+				return vm.networkOutbound
+			}),
+		vmCounter("goat_vm_cpu_seconds_total",
+			"represents CPU time accumulated from successive records of the given virtual machine/server.",
+			vmLabels, func(vm vmRecord) counter {
+				return vm.cpuDuration
+			}),
+		vmCounter("goat_vm_wall_seconds_total",
+			"represents running time accumulated from successive records of the given virtual machine/server.",
+			vmLabels, func(vm vmRecord) counter {
+				return vm.wallDuration
+			}),
+	}, &distribution{
+		name:    "goat_vm_allocated_memory_bytes",
+		help:    "represents the distribution of memory sizes of virtual machines/servers per site.",
+		field:   "SiteName",
+		buckets: prometheus.ExponentialBuckets(512*mebibyte, 2, 11),
+		value: func(rec interface{}) (float64, bool) {
+			memory, ok := uint64Value(rec.(vmRecord).Memory)
+			return memory * mebibyte, ok
 		},
-	)
-
-	vmg.SuspendDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "SuspendDuration",
-		Help: "represents the time when the given virtual machine/server was suspended. " +
-			"The value is counted as END_TIME - START_TIME - WALL_DURATION",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
+	}, &distribution{
+		name:    "goat_vm_allocated_cpus",
+		help:    "represents the distribution of the number of CPUs of virtual machines/servers per site.",
+		field:   "SiteName",
+		buckets: prometheus.ExponentialBuckets(1, 2, 8),
+		value: func(rec interface{}) (float64, bool) {
+			return float64(rec.(vmRecord).CPUCount), true
 		},
-	)
-
-	vmg.WallDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "WallDuration",
-		Help:      "represents the time when the given virtual machine/server was running.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
-
-	vmg.CPUDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "CPUDuration",
-		Help:      "represents the time when the given CPU was running. Same as WallDuration.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
-
-	vmg.CPUCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "CPUCount",
-		Help:      "represents the number of CPUs.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
-
-	vmg.NetworkInbound = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "NetworkInbound",
-		Help:      "represents network inbound.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-			"NetworkType",
-		},
-	)
-
-	vmg.NetworkOutbound = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "NetworkOutbound",
-		Help:      "represents network outbound.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-			"NetworkType",
-		},
-	)
-
-	vmg.PublicIPCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "PublicIPCount",
-		Help:      "represents the number of used public IPs.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
-
-	vmg.Memory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "Memory",
-		Help:      "represents the size of memory.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
-
-	vmg.Disk = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "vm",
-		Name:      "Disk",
-		Help:      "represents the size of disks.",
-	},
-		[]string{
-			"VMUUID",
-			"SiteName",
-			"LocalUserID",
-			"LocalGroupID",
-			"GlobalUserName",
-		},
-	)
+	})}
+}
 
-	return &vmg
+// vmRecord is a stored vm/server record with counters accumulated from successive records of the same VMUUID.
+type vmRecord struct {
+	record.VM
+	networkInbound  counter
+	networkOutbound counter
+	cpuDuration     counter
+	wallDuration    counter
 }
 
-// Register registers vm/server gauge.
-func (vmg *VMGauge) Register() {
-	gauges := []prometheus.Collector{
-		vmg.Timestamp,
-		vmg.StartTime,
-		vmg.EndTime,
-		vmg.SuspendDuration,
-		vmg.WallDuration,
-		vmg.CPUDuration,
-		vmg.CPUCount,
-		vmg.NetworkInbound,
-		vmg.NetworkOutbound,
-		vmg.PublicIPCount,
-		vmg.Memory,
-		vmg.Disk,
+// counter accumulates a cumulative value of successive records, so it is monotonic even when the value
+// of a record drops (e.g. a virtual machine/server is restarted).
+type counter struct {
+	last  float64
+	total float64
+	set   bool
+}
+
+// add adds the difference between a given value and the previous one, the whole value is added
+// when it is the first one or when it is lower than the previous one.
+func (c counter) add(value float64, ok bool) counter {
+	if !ok {
+		return c
 	}
 
-	prometheus.MustRegister(gauges...)
+	delta := value - c.last
+	if !c.set || delta < 0 {
+		delta = value
+	}
 
-	logrus.WithField("resource", "vm").Debug("gauges registered")
+	return counter{last: value, total: c.total + delta, set: true}
 }
 
-// Export exports vm/server gauges to Prometheus.
+// Export stores vm/server records, the previous record with the same VMUUID is replaced
+// and its counters are increased by the new record. A record measured before the previous one
+// (e.g. an older file processed again) is stale and it is ignored.
 func (vmg *VMGauge) Export(rec record.Record) {
-	vms := rec.(record.VMs)
-
-	for _, vm := range vms.VMs {
-		vmg.Timestamp.With(labelForVMTimestamp(vm)).Set(float64(time.Now().Unix()))
-
-		labelNetwork := labelForVM(vm)
-		labelNetwork["NetworkType"] = ""
-		if vm.NetworkType != nil {
-			labelNetwork["NetworkType"] = *vm.NetworkType
-		}
-
-		if vm.StartTime != nil {
-			vmg.StartTime.With(labelForVM(vm)).Set(utils.StrToF64(*vm.StartTime))
-		}
-
-		if vmg.EndTime != nil {
-			vmg.EndTime.With(labelForVM(vm)).Set(utils.StrToF64(*vm.EndTime))
-		}
-
-		if vm.SuspendDuration != nil {
-			vmg.SuspendDuration.With(labelForVM(vm)).Set(utils.StrToF64(*vm.SuspendDuration))
-		}
-
-		if vm.WallDuration != nil {
-			vmg.WallDuration.With(labelForVM(vm)).Set(utils.StrToF64(*vm.WallDuration))
-		}
-
-		if vm.CPUDuration != nil {
-			vmg.CPUDuration.With(labelForVM(vm)).Set(utils.StrToF64(*vm.CPUDuration))
-		}
-
-		vmg.CPUCount.With(labelForVM(vm)).Set(float64(vm.CPUCount))
-
-		if vm.NetworkInbound != nil {
-			vmg.NetworkInbound.With(labelNetwork).Set(float64(*vm.NetworkInbound))
-		}
-
-		if vm.NetworkOutbound != nil {
-			vmg.NetworkOutbound.With(labelNetwork).Set(float64(*vm.NetworkOutbound))
-		}
-
-		if vm.PublicIPCount != nil {
-			vmg.PublicIPCount.With(labelForVM(vm)).Set(float64(*vm.PublicIPCount))
-		}
-
-		if vm.Memory != nil {
-			vmg.Memory.With(labelForVM(vm)).Set(float64(*vm.Memory))
-		}
-
-		if vm.Disk != nil {
-			vmg.Disk.With(labelForVM(vm)).Set(float64(*vm.Disk))
-		}
+	entries, source := vmg.Entries(rec)
+	for _, e := range entries {
+		vm := e.Record.(record.VM)
+		vmg.store.update(source, e.Key, func(previous interface{}) interface{} {
+			r := vmRecord{}
+			if previous != nil {
+				r = previous.(vmRecord)
+				if stale(vm, r.VM) {
+					return r
+				}
+			}
+
+			r.VM = vm
+			r.networkInbound = r.networkInbound.add(uint64Value(vm.NetworkInbound))
+			r.networkOutbound = r.networkOutbound.add(uint64Value(vm.NetworkOutbound))
+			r.cpuDuration = r.cpuDuration.add(seconds(vm.CPUDuration))
+			r.wallDuration = r.wallDuration.add(seconds(vm.WallDuration))
+
+			return r
+		})
 	}
 }
 
-func labelForVMTimestamp(vm record.VM) prometheus.Labels {
-	labels := prometheus.Labels{
-		"VMUUID":              vm.VMUUID,
-		"SiteName":            vm.SiteName,
-		"MachineName":         vm.MachineName,
-		"CloudComputeService": "",
-		"LocalUserID":         "",
-		"LocalGroupID":        "",
-		"GlobalUserName":      "",
-		"FQAN":                "",
-		"Status":              "",
-		"Benchmark":           "",
-		"BenchmarkType":       "",
-		"StorageRecordId":     "",
-		"ImageId":             "",
-		"CloudType":           "",
-	}
-
-	if vm.CloudComputeService != nil {
-		labels["CloudComputeService"] = *vm.CloudComputeService
-	}
+// RecordType returns the type of vm/server records.
+func (vmg *VMGauge) RecordType() reflect.Type {
+	return reflect.TypeOf(record.VM{})
+}
 
-	if vm.LocalUserID != nil {
-		labels["LocalUserID"] = *vm.LocalUserID
-	}
+// Entries returns vm/server records keyed by VMUUID.
+func (vmg *VMGauge) Entries(rec record.Record) ([]Entry, string) {
+	vms := rec.(record.VMs)
 
-	if vm.LocalGroupID != nil {
-		labels["LocalGroupID"] = *vm.LocalGroupID
+	entries := make([]Entry, len(vms.VMs))
+	for i, vm := range vms.VMs {
+		entries[i] = Entry{Key: vm.VMUUID, Record: vm}
 	}
 
-	if vm.GlobalUserName != nil {
-		labels["GlobalUserName"] = *vm.GlobalUserName
-	}
+	return entries, vms.Source
+}
 
-	if vm.Fqan != nil {
-		labels["FQAN"] = *vm.Fqan
-	}
+// Stale checks if a vm/server record was measured before the previous record of the same VMUUID.
+func (vmg *VMGauge) Stale(rec, previous interface{}) bool {
+	return stale(rec.(record.VM), previous.(record.VM))
+}
 
-	if vm.Status != nil {
-		labels["Status"] = *vm.Status
+// stale checks if a vm/server record was measured before the previous record of the same VMUUID.
+func stale(vm, previous record.VM) bool {
+	t, ok := measured(vm)
+	if !ok {
+		return false
 	}
 
-	if vm.Benchmark != nil {
-		labels["Benchmark"] = fmt.Sprintf("%f", *vm.Benchmark)
-	}
+	p, ok := measured(previous)
 
-	if vm.BenchmarkType != nil {
-		labels["BenchmarkType"] = *vm.BenchmarkType
-	}
+	return ok && t.Before(p)
+}
 
-	if vm.StorageRecordID != nil {
-		labels["StorageRecordId"] = *vm.StorageRecordID
+// measured returns time of the measurement of a vm/server record, the end time of a finished one or the start time
+// plus wall and suspend durations of a running one, false if it is unknown.
+func measured(vm record.VM) (time.Time, bool) {
+	if vm.EndTime != nil {
+		return *vm.EndTime, true
 	}
 
-	if vm.ImageID != nil {
-		labels["ImageId"] = *vm.ImageID
+	if vm.StartTime == nil || vm.WallDuration == nil {
+		return time.Time{}, false
 	}
 
-	if vm.CloudType != nil {
-		labels["CloudType"] = *vm.CloudType
+	t := vm.StartTime.Add(*vm.WallDuration)
+	if vm.SuspendDuration != nil {
+		t = t.Add(*vm.SuspendDuration)
 	}
 
-	return labels
+	return t, true
 }
 
-func labelForVM(vm record.VM) prometheus.Labels {
-	labels := prometheus.Labels{
-		"VMUUID":         vm.VMUUID,
-		"SiteName":       vm.SiteName,
-		"LocalUserID":    "",
-		"LocalGroupID":   "",
-		"GlobalUserName": "",
+// vmMetric creates gauge rendered from vm/server records.
+func vmMetric(name, goat, help string, labels []string,
+	value func(vm vmRecord, updated time.Time) (float64, bool)) metric {
+	return metric{
+		name:   name,
+		goat:   goat,
+		help:   help,
+		labels: labels,
+		value: func(rec interface{}, updated time.Time) (float64, bool) {
+			return value(rec.(vmRecord), updated)
+		},
 	}
+}
 
-	if vm.LocalUserID != nil {
-		labels["LocalUserID"] = *vm.LocalUserID
+// vmCounter creates counter rendered from vm/server records. Counters have no legacy names.
+func vmCounter(goat, help string, labels []string, value func(vm vmRecord) counter) metric {
+	return metric{
+		goat:   goat,
+		help:   help,
+		labels: labels,
+		value: func(rec interface{}, _ time.Time) (float64, bool) {
+			c := value(rec.(vmRecord))
+			return c.total, c.set
+		},
+		counter: true,
 	}
+}
 
-	if vm.LocalGroupID != nil {
-		labels["LocalGroupID"] = *vm.LocalGroupID
+// vmFields returns fields of vm/server record which can be exported as labels.
+func vmFields(rec interface{}) prometheus.Labels {
+	vm := rec.(vmRecord)
+
+	labels := prometheus.Labels{
+		"VMUUID":              vm.VMUUID,
+		"SiteName":            vm.SiteName,
+		"CloudComputeService": optional(vm.CloudComputeService),
+		"MachineName":         vm.MachineName,
+		"LocalUserID":         optional(vm.LocalUserID),
+		"LocalGroupID":        optional(vm.LocalGroupID),
+		"GlobalUserName":      optional(vm.GlobalUserName),
+		"FQAN":                optional(vm.Fqan),
+		"Status":              optional(vm.Status),
+		"NetworkType":         optional(vm.NetworkType),
+		"Benchmark":           "",
+		"BenchmarkType":       optional(vm.BenchmarkType),
+		"StorageRecordId":     optional(vm.StorageRecordID),
+		"ImageId":             optional(vm.ImageID),
+		"CloudType":           optional(vm.CloudType),
+		"AcceleratorType":     optional(vm.AcceleratorType),
 	}
 
-	if vm.GlobalUserName != nil {
-		labels["GlobalUserName"] = *vm.GlobalUserName
+	if vm.Benchmark != nil {
+		labels["Benchmark"] = fmt.Sprintf("%f", *vm.Benchmark)
 	}
 
 	return labels
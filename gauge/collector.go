@@ -0,0 +1,546 @@
+package gauge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Naming schemes of exported gauges.
+const (
+	// NamingGoat exports gauges with Prometheus-conventional names in goat namespace with units
+	// (e.g. goat_vm_cpu_duration_seconds) and labels in snake case.
+	NamingGoat = "goat"
+	// NamingLegacy exports gauges with legacy names in namespaces of kinds (e.g. vm_CPUDuration)
+	// and labels named as record fields.
+	NamingLegacy = "legacy"
+	// NamingBoth exports gauges with both names during migration from legacy names.
+	NamingBoth = "both"
+)
+
+// metric describes a gauge or a counter rendered from stored records of one kind at scrape time.
+type metric struct {
+	// name is the legacy name of the metric without the kind, metrics without legacy name are exported
+	// only with Prometheus-conventional name.
+	name string
+	// goat is the Prometheus-conventional name of the metric.
+	goat string
+	// scale converts the value to the base unit of the Prometheus-conventional name, zero means no conversion.
+	scale float64
+	help  string
+	// labels are record fields exported as labels by default.
+	labels []string
+	// legacyLabels are record fields exported as labels of the legacy name by default when they differ
+	// from labels, so the legacy series keep the labels of older versions.
+	legacyLabels []string
+	// value returns value of the gauge for a record updated at a given time, false if the record has no value.
+	value func(rec interface{}, updated time.Time) (float64, bool)
+	// counter is true for monotonic counters.
+	counter bool
+}
+
+// legacy returns record fields exported as labels of the legacy name by default.
+func (m metric) legacy() []string {
+	if m.legacyLabels != nil {
+		return m.legacyLabels
+	}
+
+	return m.labels
+}
+
+// distribution describes a histogram of values of stored records of one kind per value of a record field.
+// Histograms are exported only with Prometheus-conventional names.
+type distribution struct {
+	name    string
+	help    string
+	field   string
+	buckets []float64
+	// value returns the observed value of a record, false if the record has no value.
+	value func(rec interface{}) (float64, bool)
+	desc  *prometheus.Desc
+}
+
+// histogram is a histogram of values of one distribution for one value of its field and values of static labels.
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // non-cumulative counts per bucket
+	count       uint64
+	sum         float64
+}
+
+// LabelConfig configures labels of gauges of one kind of records. Labels maps names of metrics to record fields
+// exported as their labels, metrics which are not listed keep their default labels. Relabel rules are applied
+// in order to labels of all metrics of the kind. Labels are named as record fields in the rules and they are
+// converted to snake case afterwards when gauges are exported with Prometheus-conventional names.
+type LabelConfig struct {
+	Labels  map[string][]string `mapstructure:"labels"`
+	Relabel []RelabelConfig     `mapstructure:"relabel"`
+}
+
+// collector stores the latest records of one kind and renders their gauges at scrape time,
+// so only records are kept in memory instead of a series for every field of every record.
+type collector struct {
+	kind    string
+	metrics []metric
+	// fields returns values of record fields which can be exported as labels.
+	fields    func(rec interface{}) prometheus.Labels
+	available prometheus.Labels
+	selected  [2][][]string // record fields exported as labels per metric for Prometheus-conventional and legacy names
+	labels    [2][][]string // label names after relabeling per metric for Prometheus-conventional and legacy names
+	relabels  []relabel
+	static    StaticLabels
+	series    []series
+	// distributions are histograms of values of records.
+	distributions []*distribution
+	store         *store
+}
+
+// Indexes of labels of Prometheus-conventional and legacy names.
+const (
+	goatNames = iota
+	legacyNames
+)
+
+// series is an exported form of a metric with legacy or Prometheus-conventional name. Selected are record fields
+// exported as its labels and labels are names of the labels after relabeling.
+type series struct {
+	metric    int
+	selected  []string
+	labels    []string
+	name      string
+	scale     float64
+	valueType prometheus.ValueType
+	desc      *prometheus.Desc
+}
+
+// sample is a value of one series rendered from a record.
+type sample struct {
+	labelValues []string
+	value       float64
+	updated     time.Time
+}
+
+// newCollector creates collector of gauges with default labels and Prometheus-conventional names.
+// Zero is an empty record of the kind, its fields are the fields which can be exported as labels.
+func newCollector(kind string, zero interface{}, fields func(rec interface{}) prometheus.Labels,
+	metrics []metric, distributions ...*distribution) *collector {
+	c := &collector{kind: kind, metrics: metrics, fields: fields, available: fields(zero),
+		distributions: distributions, store: newStore()}
+
+	for _, m := range metrics {
+		c.selected[goatNames] = append(c.selected[goatNames], m.labels)
+		c.selected[legacyNames] = append(c.selected[legacyNames], m.legacy())
+	}
+	c.labels = c.selected
+	c.describe(NamingGoat)
+
+	return c
+}
+
+// Configure sets naming scheme, record fields exported as labels, relabel rules and static labels. It has to be
+// called before the gauges are registered.
+func (c *collector) Configure(naming string, cfg LabelConfig, static StaticLabels) error {
+	switch naming {
+	case NamingGoat, NamingLegacy, NamingBoth:
+	default:
+		return fmt.Errorf("unknown naming: %s", naming)
+	}
+
+	var selected [2][][]string
+	for _, m := range c.metrics {
+		selected[goatNames] = append(selected[goatNames], m.labels)
+		selected[legacyNames] = append(selected[legacyNames], m.legacy())
+	}
+
+	for name, fields := range cfg.Labels {
+		i := c.metricIndex(name)
+		if i < 0 {
+			return fmt.Errorf("unknown %s metric: %s", c.kind, name)
+		}
+
+		for _, field := range fields {
+			if _, ok := c.available[field]; !ok {
+				return fmt.Errorf("unknown field of %s record: %s", c.kind, field)
+			}
+		}
+		selected[goatNames][i], selected[legacyNames][i] = fields, fields
+	}
+
+	relabels, err := compileRelabels(cfg.Relabel)
+	if err != nil {
+		return err
+	}
+
+	var labels [2][][]string
+	for names := range selected {
+		labels[names] = make([][]string, len(c.metrics))
+		for i, m := range c.metrics {
+			labels[names][i] = selected[names][i]
+			for _, r := range relabels {
+				if labels[names][i], err = r.names(labels[names][i]); err != nil {
+					return err
+				}
+			}
+
+			if err = uniqueSnakeCase(append(append([]string(nil), labels[names][i]...), static.Names...)); err != nil {
+				return fmt.Errorf("%s metric %s: %v", c.kind, m.name, err)
+			}
+		}
+	}
+
+	for _, d := range c.distributions {
+		if err = uniqueSnakeCase(append([]string{d.field}, static.Names...)); err != nil {
+			return fmt.Errorf("%s histogram %s: %v", c.kind, d.name, err)
+		}
+	}
+
+	c.selected, c.labels, c.relabels, c.static = selected, labels, relabels, static
+	c.describe(naming)
+
+	return nil
+}
+
+// metricIndex returns index of a metric with a given legacy name regardless of case or with a given
+// Prometheus-conventional name, -1 if there is no such metric.
+func (c *collector) metricIndex(name string) int {
+	for i, m := range c.metrics {
+		if strings.EqualFold(m.name, name) || m.goat == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// describe creates series of gauges with their current labels according to a naming scheme.
+func (c *collector) describe(naming string) {
+	goat := naming == NamingGoat || naming == NamingBoth
+
+	c.series = nil
+	for i, m := range c.metrics {
+		valueType := prometheus.GaugeValue
+		if m.counter {
+			valueType = prometheus.CounterValue
+		}
+
+		if goat {
+			scale := m.scale
+			if scale == 0 {
+				scale = 1
+			}
+
+			labels := make([]string, len(c.labels[goatNames][i]))
+			for j, name := range c.labels[goatNames][i] {
+				labels[j] = SnakeCase(name)
+			}
+			labels = append(labels, c.static.Names...)
+
+			c.series = append(c.series, series{metric: i, selected: c.selected[goatNames][i],
+				labels: c.labels[goatNames][i], name: m.goat, scale: scale, valueType: valueType,
+				desc: prometheus.NewDesc(m.goat, m.help, labels, nil)})
+		}
+
+		if (naming == NamingLegacy || naming == NamingBoth) && m.name != "" {
+			name := prometheus.BuildFQName(c.kind, "", m.name)
+			c.series = append(c.series, series{metric: i, selected: c.selected[legacyNames][i],
+				labels: c.labels[legacyNames][i], name: name, scale: 1, valueType: valueType,
+				desc: prometheus.NewDesc(name, m.help, append(append([]string(nil), c.labels[legacyNames][i]...),
+					c.static.Names...), nil)})
+		}
+	}
+
+	for _, d := range c.distributions {
+		d.desc = nil
+		if goat {
+			d.desc = prometheus.NewDesc(d.name, d.help, append([]string{SnakeCase(d.field)}, c.static.Names...), nil)
+		}
+	}
+}
+
+// Describe sends descriptions of all gauges.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, s := range c.series {
+		ch <- s.desc
+	}
+
+	for _, d := range c.distributions {
+		if d.desc != nil {
+			ch <- d.desc
+		}
+	}
+}
+
+// Collect renders gauges and histograms of all stored records. When more records render a series with the same
+// labels, the value from the most recently updated record is used for a gauge and the values of all the records
+// are summed for a counter.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	samples := make([]map[string]sample, len(c.series))
+	for i := range samples {
+		samples[i] = make(map[string]sample)
+	}
+
+	histograms := make([]map[string]*histogram, len(c.distributions))
+	for i := range histograms {
+		histograms[i] = make(map[string]*histogram)
+	}
+
+	c.store.each(func(rec interface{}, source string, updated time.Time) {
+		fields := c.fields(rec)
+		static := c.staticValues(source)
+
+		for i, d := range c.distributions {
+			if d.desc != nil {
+				d.observe(histograms[i], append([]string{fields[d.field]}, static...), rec)
+			}
+		}
+
+		for i, s := range c.series {
+			value, ok := c.metrics[s.metric].value(rec, updated)
+			if !ok {
+				continue
+			}
+
+			labels, ok := c.relabel(s.name, fields, s.selected)
+			if !ok {
+				continue
+			}
+
+			values := make([]string, len(s.labels), len(s.labels)+len(static))
+			for j, name := range s.labels {
+				values[j] = labels[name]
+			}
+			values = append(values, static...)
+
+			value *= s.scale
+
+			key := strings.Join(values, "\xff")
+			if previous, ok := samples[i][key]; ok {
+				if s.valueType == prometheus.CounterValue {
+					value += previous.value
+				} else if previous.updated.After(updated) {
+					continue
+				}
+			}
+			samples[i][key] = sample{labelValues: values, value: value, updated: updated}
+		}
+	})
+
+	for i, s := range c.series {
+		for _, sample := range samples[i] {
+			m, err := prometheus.NewConstMetric(s.desc, s.valueType, sample.value, sample.labelValues...)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"error": err, "resource": c.kind}).Error("error render gauge")
+				continue
+			}
+
+			ch <- m
+		}
+	}
+
+	for i, d := range c.distributions {
+		for _, h := range histograms[i] {
+			m, err := prometheus.NewConstHistogram(d.desc, h.count, h.sum, d.cumulative(h), h.labelValues...)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"error": err, "resource": c.kind}).Error("error render histogram")
+				continue
+			}
+
+			ch <- m
+		}
+	}
+}
+
+// observe adds value of a record to the histogram of given label values, the value of the field
+// of the distribution followed by values of static labels.
+func (d *distribution) observe(histograms map[string]*histogram, labelValues []string, rec interface{}) {
+	value, ok := d.value(rec)
+	if !ok {
+		return
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	h, ok := histograms[key]
+	if !ok {
+		h = &histogram{labelValues: labelValues, counts: make([]uint64, len(d.buckets))}
+		histograms[key] = h
+	}
+
+	for i, bound := range d.buckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// cumulative returns cumulative counts of a histogram by upper bounds of buckets.
+func (d *distribution) cumulative(h *histogram) map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(d.buckets))
+
+	var count uint64
+	for i, bound := range d.buckets {
+		count += h.counts[i]
+		buckets[bound] = count
+	}
+
+	return buckets
+}
+
+// staticValues returns values of static labels of records from a given source.
+func (c *collector) staticValues(source string) []string {
+	if len(c.static.Names) == 0 {
+		return nil
+	}
+
+	var labels map[string]string
+	if c.static.Values != nil {
+		labels = c.static.Values(source)
+	}
+
+	values := make([]string, len(c.static.Names))
+	for i, name := range c.static.Names {
+		values[i] = labels[name]
+	}
+
+	return values
+}
+
+// relabel returns labels of a series with a given name from selected record fields after relabel rules
+// are applied, false if the series is dropped.
+func (c *collector) relabel(name string, fields prometheus.Labels, selected []string) (prometheus.Labels, bool) {
+	labels := make(prometheus.Labels, len(selected))
+	for _, field := range selected {
+		labels[field] = fields[field]
+	}
+
+	for _, r := range c.relabels {
+		if !r.apply(name, labels) {
+			return nil, false
+		}
+	}
+
+	return labels, true
+}
+
+// Register registers gauges to a given registerer.
+func (c *collector) Register(reg prometheus.Registerer) {
+	reg.MustRegister(c)
+
+	logrus.WithField("resource", c.kind).Debug("gauges registered")
+}
+
+// Retire deletes records which come only from a given source file.
+func (c *collector) Retire(source string) {
+	deleted := c.store.retire(source)
+
+	logrus.WithFields(logrus.Fields{"resource": c.kind, "source": source, "records": deleted}).Debug(
+		"records retired")
+}
+
+// Expire deletes records not refreshed for longer than ttl and returns the number of deleted records.
+func (c *collector) Expire(ttl time.Duration) int {
+	deleted := c.store.expire(ttl)
+
+	logrus.WithFields(logrus.Fields{"resource": c.kind, "records": deleted}).Debug("records expired")
+
+	return deleted
+}
+
+// mebibyte is the number of bytes in MiB.
+const mebibyte = 1 << 20
+
+// scaled sets scale converting value of a metric to the base unit of its Prometheus-conventional name.
+func scaled(scale float64, m metric) metric {
+	m.scale = scale
+	return m
+}
+
+// legacyLabeled sets record fields exported as labels of the legacy name of a metric by default.
+func legacyLabeled(labels []string, m metric) metric {
+	m.legacyLabels = labels
+	return m
+}
+
+// unixTime returns optional time in seconds since epoch, false if it is not set.
+func unixTime(t *time.Time) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	return float64(t.Unix()), true
+}
+
+// seconds returns optional duration in seconds, false if it is not set.
+func seconds(d *time.Duration) (float64, bool) {
+	if d == nil {
+		return 0, false
+	}
+
+	return d.Seconds(), true
+}
+
+// uint64Value returns optional unsigned integer, false if it is not set.
+func uint64Value(u *uint64) (float64, bool) {
+	if u == nil {
+		return 0, false
+	}
+
+	return float64(*u), true
+}
+
+// optional returns value of an optional string, empty string if it is not set.
+func optional(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+// SnakeCase converts name of a record field to snake case, e.g. LocalUserID to local_user_id.
+func SnakeCase(name string) string {
+	if snake, ok := snakeCaseExceptions[name]; ok {
+		return snake
+	}
+
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// snakeCaseExceptions are record fields whose acronyms cannot be split automatically.
+var snakeCaseExceptions = map[string]string{
+	"VMUUID": "vm_uuid",
+}
+
+// uniqueSnakeCase returns an error if more label names have the same name in snake case.
+func uniqueSnakeCase(names []string) error {
+	seen := make(map[string]string)
+	for _, name := range names {
+		snake := SnakeCase(name)
+		if other, ok := seen[snake]; ok {
+			return fmt.Errorf("labels %s and %s are both named %s in snake case", other, name, snake)
+		}
+		seen[snake] = name
+	}
+
+	return nil
+}
@@ -1,24 +1,150 @@
 package gauge
 
-// Gauge represents all gauges.
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exporter exports records of one kind to Prometheus using its gauges.
+type Exporter interface {
+	// Register registers gauges to a given registerer.
+	Register(reg prometheus.Registerer)
+	// Export exports records to gauges.
+	Export(rec record.Record)
+	// Retire deletes records which come only from a given source file.
+	Retire(source string)
+	// Expire deletes records not refreshed for longer than ttl and returns the number of deleted records.
+	Expire(ttl time.Duration) int
+}
+
+// Configurable is implemented by exporters with configurable names and labels.
+type Configurable interface {
+	// Configure sets naming scheme, record fields exported as labels, relabel rules and static labels.
+	Configure(naming string, cfg LabelConfig, static StaticLabels) error
+}
+
+// Entry is a single record of a batch identified by its key, a record replaces the previous record with the same key.
+type Entry struct {
+	Key    string
+	Record interface{}
+}
+
+// Keyed is implemented by exporters which keep the latest record of every key. Records of kinds with keyed
+// exporters can be totalled by rollups, which then identify records by the same keys as the gauges.
+type Keyed interface {
+	// RecordType returns the type of a single record.
+	RecordType() reflect.Type
+	// Entries returns single records of a batch and the source file of the batch.
+	Entries(rec record.Record) ([]Entry, string)
+	// Stale checks if a single record is older than the previous record with the same key, so it is ignored.
+	Stale(rec, previous interface{}) bool
+}
+
+// StaticLabels are labels attached to all series of records by the source of records (e.g. labels of a watched
+// root directory). Names are names of the labels, Values returns values of the labels for a source, labels
+// without a value are empty. Static labels are not relabeled and they are not attached when Names are empty.
+type StaticLabels struct {
+	Names  []string
+	Values func(source string) map[string]string
+}
+
+// Gauge represents gauges of all kinds of records registered to one registerer. Expired records are counted
+// by metrics of the same pipeline.
 type Gauge struct {
-	VMGauge      *VMGauge
-	IPGauge      *IPGauge
-	StorageGauge *StorageGauge
+	exporters  map[string]Exporter
+	kinds      []string
+	registerer prometheus.Registerer
+	metrics    *metrics.Metrics
+}
+
+// CreateAll creates gauges for all built-in kinds of records registered to a given registerer,
+// expired records are counted by given metrics.
+func CreateAll(reg prometheus.Registerer, m *metrics.Metrics) *Gauge {
+	g := &Gauge{exporters: make(map[string]Exporter), registerer: reg, metrics: m}
+
+	g.Add(record.KindVM, NewVMGauge())
+	g.Add(record.KindIP, NewIPGauge())
+	g.Add(record.KindStorage, NewStorageGauge())
+
+	return g
 }
 
-// CreateAll creates all gauges.
-func CreateAll() *Gauge {
-	return &Gauge{
-		VMGauge:      NewVMGauge(),
-		IPGauge:      NewIPGauge(),
-		StorageGauge: NewStorageGauge(),
+// Add adds gauges exporting records of a given kind. Gauges of already added kind are replaced.
+func (g *Gauge) Add(kind string, exporter Exporter) {
+	if _, ok := g.exporters[kind]; !ok {
+		g.kinds = append(g.kinds, kind)
 	}
+
+	g.exporters[kind] = exporter
+}
+
+// Keyed returns the exporter of records of a given kind when it is keyed.
+func (g Gauge) Keyed(kind string) (Keyed, bool) {
+	keyed, ok := g.exporters[kind].(Keyed)
+	return keyed, ok
 }
 
-// RegistryAll registers all gauges.
+// Kinds returns kinds of records with gauges in the order they were added.
+func (g Gauge) Kinds() []string {
+	return append([]string(nil), g.kinds...)
+}
+
+// Configure configures naming scheme and static labels of all gauges and labels of gauges per kind of records.
+// It has to be called before gauges are registered.
+func (g *Gauge) Configure(naming string, configs map[string]LabelConfig, static StaticLabels) error {
+	for kind := range configs {
+		if _, ok := g.exporters[kind]; !ok {
+			return fmt.Errorf("no gauges of kind: %s", kind)
+		}
+	}
+
+	for _, kind := range g.kinds {
+		cfg, configured := configs[kind]
+
+		configurable, ok := g.exporters[kind].(Configurable)
+		if !ok {
+			if configured || len(static.Names) > 0 {
+				return fmt.Errorf("labels of %s gauges are not configurable", kind)
+			}
+			continue
+		}
+
+		if err := configurable.Configure(naming, cfg, static); err != nil {
+			return fmt.Errorf("%s gauges: %v", kind, err)
+		}
+	}
+
+	return nil
+}
+
+// RegistryAll registers all gauges to the registerer of gauges.
 func (g Gauge) RegistryAll() {
-	g.VMGauge.Register()
-	g.IPGauge.Register()
-	g.StorageGauge.Register()
+	for _, kind := range g.kinds {
+		g.exporters[kind].Register(g.registerer)
+	}
+}
+
+// Export exports records by gauges of their kind. It returns false when there are no gauges for the kind.
+func (g Gauge) Export(rec record.Record) bool {
+	exporter, ok := g.exporters[rec.Kind()]
+	if !ok {
+		return false
+	}
+
+	exporter.Export(rec)
+
+	return true
+}
+
+// RetireAll deletes records of all kinds which come only from a given source file.
+func (g Gauge) RetireAll(source string) {
+	for _, kind := range g.kinds {
+		g.exporters[kind].Retire(source)
+	}
 }
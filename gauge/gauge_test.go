@@ -0,0 +1,500 @@
+package gauge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gauge Suite")
+}
+
+var _ = Describe("Gauge tests", func() {
+	var (
+		registry        *prometheus.Registry
+		gauges          *Gauge
+		instrumentation *metrics.Metrics
+	)
+
+	BeforeEach(func() {
+		registry = prometheus.NewRegistry()
+		instrumentation = metrics.New()
+		gauges = CreateAll(registry, instrumentation)
+		gauges.RegistryAll()
+	})
+
+	Describe("registering gauges", func() {
+		Context("when gauges are created for another registry", func() {
+			It("should not panic", func() {
+				Expect(func() {
+					CreateAll(prometheus.NewRegistry(), metrics.New()).RegistryAll()
+				}).NotTo(Panic())
+			})
+		})
+	})
+
+	Describe("exporting records", func() {
+		Context("when vm record is exported", func() {
+			It("should be gathered from the registry", func() {
+				start := time.Unix(1578317745, 0)
+				wall := 9411 * time.Second
+
+				ok := gauges.Export(record.VMs{
+					VMs: []record.VM{{
+						VMUUID:       "fe1e6de8-149b-472a-b815-6a79bab50df9",
+						SiteName:     "goat-vm-site-name",
+						MachineName:  "one-57502",
+						StartTime:    &start,
+						WallDuration: &wall,
+					}},
+					Source: "records",
+				})
+				Expect(ok).To(BeTrue())
+
+				values := gathered(registry)
+				Expect(values).To(HaveKeyWithValue("goat_vm_start_time_seconds", float64(1578317745)))
+				Expect(values).To(HaveKeyWithValue("goat_vm_wall_duration_seconds", float64(9411)))
+			})
+		})
+
+		Context("when ip records of both versions are exported for the same user", func() {
+			It("should keep a series per version", func() {
+				ips := []record.IP{
+					{SiteName: "site", LocalUser: "16", IPVersion: 4, IPCount: 5},
+					{SiteName: "site", LocalUser: "16", IPVersion: 6, IPCount: 2},
+				}
+				gauges.Export(record.IPs{Ips: ips, Source: "records"})
+
+				Expect(all(registry, "goat_ip_addresses", "ip_version")).To(Equal(map[string]float64{"4": 5, "6": 2}))
+
+				ips[1].IPCount = 3
+				gauges.Export(record.IPs{Ips: ips[1:], Source: "records"})
+
+				Expect(all(registry, "goat_ip_addresses", "ip_version")).To(Equal(map[string]float64{"4": 5, "6": 3}))
+			})
+		})
+
+		Context("when vm record with the same VMUUID is exported again", func() {
+			It("should be replaced", func() {
+				vm := record.VM{VMUUID: "fe1e6de8-149b-472a-b815-6a79bab50df9", CPUCount: 1}
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "old"})
+
+				vm.CPUCount = 4
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "new"})
+
+				Expect(gathered(registry)).To(HaveKeyWithValue("goat_vm_cpus", float64(4)))
+			})
+		})
+
+		Context("when source of records is retired", func() {
+			It("should delete records only from the source", func() {
+				gauges.Export(record.VMs{VMs: []record.VM{{VMUUID: "1", CPUCount: 1}, {VMUUID: "2", CPUCount: 2}},
+					Source: "old"})
+				gauges.Export(record.VMs{VMs: []record.VM{{VMUUID: "2", CPUCount: 4}}, Source: "new"})
+
+				gauges.RetireAll("old")
+
+				Expect(all(registry, "goat_vm_cpus", "vm_uuid")).To(Equal(map[string]float64{"2": 4}))
+
+				gauges.RetireAll("new")
+
+				Expect(all(registry, "goat_vm_cpus", "vm_uuid")).To(BeEmpty())
+			})
+		})
+
+		Context("when records are expired", func() {
+			It("should delete them and count them", func() {
+				gauges.Export(record.IPs{Ips: []record.IP{{SiteName: "site", IPCount: 2}}, Source: "records"})
+				Expect(gathered(registry)).To(HaveKeyWithValue("goat_ip_addresses", float64(2)))
+
+				gauges.ExpireAll(TTL{record.KindIP: time.Nanosecond})
+
+				Expect(gathered(registry)).NotTo(HaveKey("goat_ip_addresses"))
+				Expect(testutil.ToFloat64(instrumentation.ExpiredRecords.WithLabelValues(record.KindIP))).To(
+					Equal(1.0))
+			})
+		})
+
+		Context("when TTL of records is not set", func() {
+			It("should keep them", func() {
+				gauges.Export(record.VMs{VMs: []record.VM{{VMUUID: "1", CPUCount: 1}}, Source: "records"})
+				gauges.Export(record.IPs{Ips: []record.IP{{SiteName: "site", IPCount: 2}}, Source: "records"})
+
+				gauges.ExpireAll(TTL{record.KindIP: time.Nanosecond, record.KindVM: 0})
+
+				Expect(all(registry, "goat_vm_cpus", "vm_uuid")).To(Equal(map[string]float64{"1": 1}))
+				Expect(gathered(registry)).NotTo(HaveKey("goat_ip_addresses"))
+			})
+		})
+
+		Context("when janitor runs", func() {
+			It("should expire records periodically", func() {
+				gauges.Export(record.VMs{VMs: []record.VM{{VMUUID: "1", CPUCount: 1}}, Source: "records"})
+
+				go gauges.Janitor(10*time.Millisecond, TTL{record.KindVM: time.Nanosecond})
+
+				Eventually(func() map[string]float64 { return all(registry, "goat_vm_cpus", "vm_uuid") }).Should(BeEmpty())
+			})
+		})
+
+		Context("when janitor interval is not positive", func() {
+			It("should return without expiring records", func() {
+				gauges.Export(record.VMs{VMs: []record.VM{{VMUUID: "1", CPUCount: 1}}, Source: "records"})
+
+				gauges.Janitor(0, TTL{record.KindVM: time.Nanosecond})
+
+				Expect(all(registry, "goat_vm_cpus", "vm_uuid")).To(Equal(map[string]float64{"1": 1}))
+			})
+		})
+
+		Context("when record kind has no gauges", func() {
+			It("should not be exported", func() {
+				Expect(gauges.Export(record.Retired{Source: "records"})).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("counting and distributing values", func() {
+		vm := func(uuid string, inbound uint64, memory uint64, cpus uint32) record.VM {
+			return record.VM{VMUUID: uuid, SiteName: "site", NetworkInbound: &inbound, Memory: &memory,
+				CPUCount: cpus}
+		}
+
+		Context("when successive records of a virtual machine are exported", func() {
+			It("should add their differences to counters", func() {
+				gauges.Export(record.VMs{VMs: []record.VM{vm("1", 100, 1024, 1)}, Source: "first"})
+				gauges.Export(record.VMs{VMs: []record.VM{vm("1", 150, 1024, 1)}, Source: "second"})
+				Expect(gathered(registry)).To(HaveKeyWithValue("goat_vm_network_inbound_bytes_total", float64(150)))
+
+				// the value is lower after restart of the virtual machine
+				gauges.Export(record.VMs{VMs: []record.VM{vm("1", 20, 1024, 1)}, Source: "third"})
+				Expect(gathered(registry)).To(HaveKeyWithValue("goat_vm_network_inbound_bytes_total", float64(170)))
+			})
+		})
+
+		Context("when an older record of a virtual machine is exported again", func() {
+			It("should ignore it", func() {
+				start := time.Unix(1578317745, 0)
+				measured := func(inbound uint64, cpus uint32, wall time.Duration) record.VM {
+					r := vm("1", inbound, 1024, cpus)
+					r.StartTime, r.WallDuration = &start, &wall
+					return r
+				}
+
+				older, newer := measured(100, 1, time.Hour), measured(150, 2, 2*time.Hour)
+				gauges.Export(record.VMs{VMs: []record.VM{older}, Source: "first"})
+				gauges.Export(record.VMs{VMs: []record.VM{newer}, Source: "second"})
+				gauges.Export(record.VMs{VMs: []record.VM{older}, Source: "first"})
+
+				values := gathered(registry)
+				Expect(values).To(HaveKeyWithValue("goat_vm_network_inbound_bytes_total", float64(150)))
+				Expect(values).To(HaveKeyWithValue("goat_vm_cpus", float64(2)))
+
+				// the value is lower after restart of the virtual machine
+				restarted := measured(20, 2, 3*time.Hour)
+				gauges.Export(record.VMs{VMs: []record.VM{restarted}, Source: "third"})
+				Expect(gathered(registry)).To(HaveKeyWithValue("goat_vm_network_inbound_bytes_total", float64(170)))
+			})
+		})
+
+		Context("when labels collapse records of more virtual machines", func() {
+			It("should sum counters and keep the latest gauge", func() {
+				registry = prometheus.NewRegistry()
+				gauges = CreateAll(registry, metrics.New())
+				Expect(gauges.Configure(NamingGoat, map[string]LabelConfig{
+					record.KindVM: {Labels: map[string][]string{
+						"goat_vm_network_inbound_bytes_total": {"SiteName"},
+						"goat_vm_cpus":                        {"SiteName"},
+					}},
+				}, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+
+				gauges.Export(record.VMs{VMs: []record.VM{vm("1", 100, 1024, 1)}, Source: "first"})
+				gauges.Export(record.VMs{VMs: []record.VM{vm("2", 50, 1024, 4)}, Source: "second"})
+
+				values := gathered(registry)
+				Expect(values).To(HaveKeyWithValue("goat_vm_network_inbound_bytes_total", float64(150)))
+				Expect(values).To(HaveKeyWithValue("goat_vm_cpus", float64(4)))
+			})
+		})
+
+		Context("when records of more virtual machines are exported", func() {
+			It("should export histograms per site", func() {
+				gauges.Export(record.VMs{VMs: []record.VM{vm("1", 0, 1024, 1), vm("2", 0, 4096, 4)},
+					Source: "records"})
+
+				families, err := registry.Gather()
+				Expect(err).NotTo(HaveOccurred())
+
+				histograms := make(map[string]*dto.Histogram)
+				for _, family := range families {
+					if family.GetType() == dto.MetricType_HISTOGRAM {
+						Expect(family.GetMetric()).To(HaveLen(1))
+						histograms[family.GetName()] = family.GetMetric()[0].GetHistogram()
+					}
+				}
+
+				Expect(histograms).To(HaveKey("goat_vm_allocated_cpus"))
+				cpus := histograms["goat_vm_allocated_cpus"]
+				Expect(cpus.GetSampleCount()).To(Equal(uint64(2)))
+				Expect(cpus.GetSampleSum()).To(Equal(float64(5)))
+				Expect(cpus.GetBucket()[0].GetCumulativeCount()).To(Equal(uint64(1)))
+				Expect(cpus.GetBucket()[2].GetCumulativeCount()).To(Equal(uint64(2)))
+
+				Expect(histograms).To(HaveKey("goat_vm_allocated_memory_bytes"))
+				Expect(histograms["goat_vm_allocated_memory_bytes"].GetSampleSum()).To(Equal(float64(5120 << 20)))
+			})
+		})
+	})
+
+	Describe("naming gauges", func() {
+		var vm record.VM
+
+		BeforeEach(func() {
+			registry = prometheus.NewRegistry()
+			gauges = CreateAll(registry, metrics.New())
+
+			user := "goat-user"
+			memory := uint64(2048)
+			vm = record.VM{VMUUID: "fe1e6de8-149b-472a-b815-6a79bab50df9", SiteName: "goat-vm-site-name",
+				LocalUserID: &user, Memory: &memory}
+		})
+
+		Context("when gauges are named by Prometheus conventions", func() {
+			It("should export values in base units with labels in snake case", func() {
+				Expect(gauges.Configure(NamingGoat, nil, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "records"})
+
+				values := gathered(registry)
+				Expect(values).To(HaveKeyWithValue("goat_vm_memory_bytes", float64(2048<<20)))
+				Expect(values).NotTo(HaveKey("vm_Memory"))
+				Expect(labels(registry, "goat_vm_memory_bytes")).To(Equal(map[string]string{
+					"vm_uuid": "fe1e6de8-149b-472a-b815-6a79bab50df9", "site_name": "goat-vm-site-name",
+					"local_user_id": "goat-user", "local_group_id": "", "global_user_name": ""}))
+			})
+		})
+
+		Context("when gauges are named by both naming schemes", func() {
+			It("should export legacy names too", func() {
+				Expect(gauges.Configure(NamingBoth, nil, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "records"})
+
+				values := gathered(registry)
+				Expect(values).To(HaveKeyWithValue("goat_vm_memory_bytes", float64(2048<<20)))
+				Expect(values).To(HaveKeyWithValue("vm_Memory", float64(2048)))
+				Expect(labels(registry, "vm_Memory")).To(HaveKeyWithValue("LocalUserID", "goat-user"))
+			})
+
+			It("should keep legacy ip labels", func() {
+				Expect(gauges.Configure(NamingBoth, nil, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.IPs{Ips: []record.IP{{SiteName: "site", LocalUser: "16", IPVersion: 4,
+					IPCount: 5}}, Source: "records"})
+
+				Expect(labels(registry, "ip_IPCount")).To(Equal(map[string]string{
+					"SiteName": "site", "LocalUser": "16", "LocalGroup": "", "GlobalUserName": ""}))
+				Expect(labels(registry, "goat_ip_addresses")).To(HaveKeyWithValue("ip_version", "4"))
+			})
+		})
+
+		Context("when naming is unknown", func() {
+			It("should return an error", func() {
+				Expect(gauges.Configure("camel", nil, StaticLabels{})).NotTo(Succeed())
+			})
+		})
+	})
+
+	Describe("configuring labels", func() {
+		var vm record.VM
+
+		BeforeEach(func() {
+			registry = prometheus.NewRegistry()
+			gauges = CreateAll(registry, metrics.New())
+
+			user := "goat-user"
+			vm = record.VM{VMUUID: "fe1e6de8-149b-472a-b815-6a79bab50df9", SiteName: "goat-vm-site-name",
+				GlobalUserName: &user, CPUCount: 2}
+		})
+
+		Context("when fields of a metric are configured", func() {
+			It("should export only the fields as labels", func() {
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindVM: {Labels: map[string][]string{"cpucount": {"SiteName", "CloudType"}}},
+				}, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "records"})
+
+				Expect(labels(registry, "vm_CPUCount")).To(Equal(map[string]string{
+					"SiteName": "goat-vm-site-name", "CloudType": ""}))
+				Expect(labels(registry, "vm_Memory")).To(BeNil())
+				Expect(labels(registry, "vm_StartTime")).To(BeNil())
+			})
+		})
+
+		Context("when labels are renamed and dropped by relabel rules", func() {
+			It("should export relabeled series", func() {
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindVM: {Relabel: []RelabelConfig{
+						{Regex: str("GlobalUserName"), Replacement: str("User"), Action: ActionLabelMap},
+						{Regex: str("GlobalUserName|VMUUID"), Action: ActionLabelDrop},
+						{SourceLabels: []string{"SiteName"}, Regex: str("goat-(.*)"), TargetLabel: "Site"},
+					}},
+				}, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "records"})
+
+				Expect(labels(registry, "vm_CPUCount")).To(Equal(map[string]string{"SiteName": "goat-vm-site-name",
+					"LocalUserID": "", "LocalGroupID": "", "User": "goat-user", "Site": "vm-site-name"}))
+			})
+		})
+
+		Context("when series are dropped by relabel rule", func() {
+			It("should not export them", func() {
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindVM: {Relabel: []RelabelConfig{
+						{SourceLabels: []string{"__name__", "SiteName"}, Regex: str("vm_CPUCount;goat-.*"),
+							Action: ActionDrop},
+					}},
+				}, StaticLabels{})).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.VMs{VMs: []record.VM{vm}, Source: "records"})
+
+				values := gathered(registry)
+				Expect(values).NotTo(HaveKey("vm_CPUCount"))
+				Expect(values).To(HaveKey("vm_Timestamp"))
+			})
+		})
+
+		Context("when configuration is invalid", func() {
+			It("should return an error", func() {
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindVM: {Labels: map[string][]string{"CPUCount": {"Unknown"}}},
+				}, StaticLabels{})).NotTo(Succeed())
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindVM: {Labels: map[string][]string{"Unknown": {"SiteName"}}},
+				}, StaticLabels{})).NotTo(Succeed())
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindIP: {Relabel: []RelabelConfig{{Action: "unknown"}}},
+				}, StaticLabels{})).NotTo(Succeed())
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{
+					record.KindStorage: {Relabel: []RelabelConfig{{Regex: str("("), TargetLabel: "Site"}}},
+				}, StaticLabels{})).NotTo(Succeed())
+				Expect(gauges.Configure(NamingLegacy, map[string]LabelConfig{"unknown": {}},
+					StaticLabels{})).NotTo(Succeed())
+			})
+		})
+	})
+
+	Describe("attaching static labels", func() {
+		var static StaticLabels
+
+		BeforeEach(func() {
+			registry = prometheus.NewRegistry()
+			gauges = CreateAll(registry, metrics.New())
+
+			static = StaticLabels{Names: []string{"instance"}, Values: func(source string) map[string]string {
+				if source == "site-a/records" {
+					return map[string]string{"instance": "site-a"}
+				}
+				return nil
+			}}
+		})
+
+		Context("when records come from a source with static labels", func() {
+			It("should attach the labels to all series", func() {
+				Expect(gauges.Configure(NamingGoat, nil, static)).To(Succeed())
+				gauges.RegistryAll()
+				gauges.Export(record.VMs{VMs: []record.VM{{VMUUID: "1", SiteName: "site", CPUCount: 2}},
+					Source: "site-a/records"})
+				gauges.Export(record.IPs{Ips: []record.IP{{SiteName: "site", IPCount: 2}}, Source: "other"})
+
+				Expect(labels(registry, "goat_vm_cpus")).To(HaveKeyWithValue("instance", "site-a"))
+				Expect(labels(registry, "goat_vm_allocated_cpus")).To(Equal(map[string]string{
+					"site_name": "site", "instance": "site-a"}))
+				Expect(labels(registry, "goat_ip_addresses")).To(HaveKeyWithValue("instance", ""))
+			})
+		})
+
+		Context("when static label has the name of another label", func() {
+			It("should return an error", func() {
+				static.Names = []string{"site_name"}
+
+				Expect(gauges.Configure(NamingGoat, nil, static)).NotTo(Succeed())
+			})
+		})
+	})
+})
+
+// labels returns labels of a gathered metric with a single series, nil if there is no such metric.
+func labels(registry *prometheus.Registry, name string) map[string]string {
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) == 1 {
+			labels := make(map[string]string)
+			for _, pair := range family.GetMetric()[0].GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			return labels
+		}
+	}
+
+	return nil
+}
+
+// all returns values of all series of a gathered metric by their value of the given label.
+func all(registry *prometheus.Registry, name, label string) map[string]float64 {
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if pair.GetName() == label {
+					values[pair.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+func str(s string) *string {
+	return &s
+}
+
+// gathered returns values of gathered gauges and counters with a single series by their names.
+func gathered(registry *prometheus.Registry) map[string]float64 {
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if len(family.GetMetric()) == 1 {
+			m := family.GetMetric()[0]
+			values[family.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+
+	return values
+}
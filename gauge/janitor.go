@@ -0,0 +1,38 @@
+package gauge
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TTL represents time to live of records per kind. Records not refreshed for longer than TTL
+// are deleted together with their gauges. Zero or missing TTL means records never expire.
+type TTL map[string]time.Duration
+
+// Janitor deletes expired records periodically.
+func (g Gauge) Janitor(interval time.Duration, ttl TTL) {
+	if interval <= 0 {
+		logrus.WithField("interval", interval).Error("janitor interval has to be positive, records never expire")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.ExpireAll(ttl)
+	}
+}
+
+// ExpireAll deletes records not refreshed for longer than their TTL.
+func (g Gauge) ExpireAll(ttl TTL) {
+	for _, kind := range g.kinds {
+		if ttl[kind] > 0 {
+			deleted := g.exporters[kind].Expire(ttl[kind])
+			g.metrics.ExpiredRecords.WithLabelValues(kind).Add(float64(deleted))
+		}
+	}
+
+	logrus.Debug("expired records deleted")
+}
@@ -0,0 +1,194 @@
+package gauge
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Relabel actions.
+const (
+	// ActionReplace sets target label to replacement when regex matches joined values of source labels.
+	ActionReplace = "replace"
+	// ActionKeep drops series whose joined values of source labels do not match regex.
+	ActionKeep = "keep"
+	// ActionDrop drops series whose joined values of source labels match regex.
+	ActionDrop = "drop"
+	// ActionLabelMap copies labels whose names match regex to labels named by replacement.
+	ActionLabelMap = "labelmap"
+	// ActionLabelDrop removes labels whose names match regex.
+	ActionLabelDrop = "labeldrop"
+	// ActionLabelKeep removes labels whose names do not match regex.
+	ActionLabelKeep = "labelkeep"
+)
+
+// nameLabel is a source label with the name of the metric.
+const nameLabel = "__name__"
+
+// labelName matches valid names of Prometheus labels.
+var labelName = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// RelabelConfig is a rule changing labels of gauges in the style of Prometheus metric_relabel_configs.
+// Empty fields have the same defaults as in Prometheus - separator ";", regex "(.*)", replacement "$1"
+// and action replace. Source label __name__ holds the name of the metric. Unlike in Prometheus,
+// target label is a plain label name.
+type RelabelConfig struct {
+	SourceLabels []string `mapstructure:"source-labels"`
+	Separator    *string  `mapstructure:"separator"`
+	Regex        *string  `mapstructure:"regex"`
+	TargetLabel  string   `mapstructure:"target-label"`
+	Replacement  *string  `mapstructure:"replacement"`
+	Action       string   `mapstructure:"action"`
+}
+
+// relabel is a compiled relabel rule.
+type relabel struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// compileRelabels checks relabel rules and compiles their regular expressions.
+func compileRelabels(configs []RelabelConfig) ([]relabel, error) {
+	rules := make([]relabel, 0, len(configs))
+
+	for i, c := range configs {
+		r := relabel{
+			sourceLabels: c.SourceLabels,
+			separator:    stringOr(c.Separator, ";"),
+			targetLabel:  c.TargetLabel,
+			replacement:  stringOr(c.Replacement, "$1"),
+			action:       strings.ToLower(c.Action),
+		}
+		if r.action == "" {
+			r.action = ActionReplace
+		}
+
+		regex, err := regexp.Compile("^(?:" + stringOr(c.Regex, "(.*)") + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: %v", i+1, err)
+		}
+		r.regex = regex
+
+		switch r.action {
+		case ActionReplace:
+			if !labelName.MatchString(r.targetLabel) {
+				return nil, fmt.Errorf("relabel rule %d: invalid target label: %q", i+1, r.targetLabel)
+			}
+		case ActionKeep, ActionDrop:
+			if len(r.sourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel rule %d: %s requires source labels", i+1, r.action)
+			}
+		case ActionLabelMap, ActionLabelDrop, ActionLabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action: %s", i+1, c.Action)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// names returns names of labels after the rule is applied to labels with given names. Replace and labelmap
+// may add a label which is empty for some series, such a label is not exported for the series.
+func (r relabel) names(names []string) ([]string, error) {
+	switch r.action {
+	case ActionReplace:
+		return appendName(names, r.targetLabel), nil
+	case ActionLabelMap:
+		result := names
+		for _, name := range names {
+			if r.regex.MatchString(name) {
+				target := r.regex.ReplaceAllString(name, r.replacement)
+				if !labelName.MatchString(target) {
+					return nil, fmt.Errorf("invalid label name %q mapped from %q", target, name)
+				}
+				result = appendName(result, target)
+			}
+		}
+		return result, nil
+	case ActionLabelDrop, ActionLabelKeep:
+		var result []string
+		for _, name := range names {
+			if r.regex.MatchString(name) == (r.action == ActionLabelKeep) {
+				result = append(result, name)
+			}
+		}
+		return result, nil
+	}
+
+	return names, nil
+}
+
+// apply applies the rule to labels of a series of a given metric. It returns false when the series is dropped.
+func (r relabel) apply(metric string, labels prometheus.Labels) bool {
+	switch r.action {
+	case ActionReplace:
+		value := r.value(metric, labels)
+		match := r.regex.FindStringSubmatchIndex(value)
+		if match != nil {
+			labels[r.targetLabel] = string(r.regex.ExpandString(nil, r.replacement, value, match))
+		}
+	case ActionKeep:
+		return r.regex.MatchString(r.value(metric, labels))
+	case ActionDrop:
+		return !r.regex.MatchString(r.value(metric, labels))
+	case ActionLabelMap:
+		mapped := make(prometheus.Labels)
+		for name, value := range labels {
+			if r.regex.MatchString(name) {
+				mapped[r.regex.ReplaceAllString(name, r.replacement)] = value
+			}
+		}
+		for name, value := range mapped {
+			labels[name] = value
+		}
+	case ActionLabelDrop, ActionLabelKeep:
+		for name := range labels {
+			if r.regex.MatchString(name) != (r.action == ActionLabelKeep) {
+				delete(labels, name)
+			}
+		}
+	}
+
+	return true
+}
+
+// value returns values of source labels joined by separator.
+func (r relabel) value(metric string, labels prometheus.Labels) string {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		if name == nameLabel {
+			values[i] = metric
+			continue
+		}
+		values[i] = labels[name]
+	}
+
+	return strings.Join(values, r.separator)
+}
+
+// appendName appends a label name unless it is already present.
+func appendName(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+
+	return append(append([]string(nil), names...), name)
+}
+
+func stringOr(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+
+	return *s
+}
@@ -0,0 +1,115 @@
+package gauge
+
+import (
+	"sync"
+	"time"
+)
+
+// store holds the latest record of every key together with source files and the last update of the record,
+// so the record can be deleted when all files it comes from disappear or when it is stale.
+type store struct {
+	mutex   sync.RWMutex
+	entries map[string]*entry
+	sources map[string]map[string]struct{} // source -> keys
+}
+
+type entry struct {
+	record  interface{}
+	sources map[string]struct{}
+	source  string // the source of the latest update
+	updated time.Time
+}
+
+func newStore() *store {
+	return &store{
+		entries: make(map[string]*entry),
+		sources: make(map[string]map[string]struct{}),
+	}
+}
+
+// put stores a record with a given key, it replaces the previous record with the same key.
+func (s *store) put(source, key string, record interface{}) {
+	s.update(source, key, func(interface{}) interface{} {
+		return record
+	})
+}
+
+// update stores a record with a given key created from the previous record with the same key,
+// the previous record is nil if there is none.
+func (s *store) update(source, key string, fn func(previous interface{}) interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{sources: make(map[string]struct{})}
+		s.entries[key] = e
+	}
+	e.record = fn(e.record)
+	e.sources[source] = struct{}{}
+	e.source = source
+	e.updated = time.Now()
+
+	if _, ok = s.sources[source]; !ok {
+		s.sources[source] = make(map[string]struct{})
+	}
+	s.sources[source][key] = struct{}{}
+}
+
+// retire forgets a given source and deletes all records which come from no other source.
+// It returns the number of deleted records.
+func (s *store) retire(source string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	deleted := 0
+	for key := range s.sources[source] {
+		e := s.entries[key]
+		delete(e.sources, source)
+
+		if len(e.sources) == 0 {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+
+	delete(s.sources, source)
+
+	return deleted
+}
+
+// expire deletes all records not updated for longer than ttl. It returns the number of deleted records.
+func (s *store) expire(ttl time.Duration) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	deleted := 0
+	now := time.Now()
+	for key, e := range s.entries {
+		if now.Sub(e.updated) <= ttl {
+			continue
+		}
+
+		delete(s.entries, key)
+		deleted++
+
+		for source := range e.sources {
+			delete(s.sources[source], key)
+			if len(s.sources[source]) == 0 {
+				delete(s.sources, source)
+			}
+		}
+	}
+
+	return deleted
+}
+
+// each calls fn for every stored record with the source and the time of its last update.
+func (s *store) each(fn func(record interface{}, source string, updated time.Time)) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, e := range s.entries {
+		fn(e.record, e.source, e.updated)
+	}
+}
@@ -0,0 +1,268 @@
+package ledger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry represents a processed file.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash"`
+	Records int       `json:"records"`
+}
+
+// logSuffix is the suffix of the log of changes made since the ledger file was written.
+const logSuffix = ".log"
+
+// minCompaction is the least number of logged changes which are compacted into the ledger file.
+const minCompaction = 1000
+
+// change is a line of the log of changes, an added entry or a removed path.
+type change struct {
+	Entry
+	Removed bool `json:"removed,omitempty"`
+}
+
+// Ledger keeps processed files in a file on disk, so they are not processed again after restart.
+// Added and removed entries are appended to a log next to the ledger file, so a change costs the same
+// regardless of the size of the ledger. The log is compacted into the ledger file once it has more
+// changes than the ledger has entries, when the ledger is opened and when it is closed.
+type Ledger struct {
+	path    string
+	mutex   sync.Mutex
+	entries map[string]Entry
+	log     *os.File
+	changes int
+}
+
+// Open opens ledger stored in a given file. Empty ledger is created when the file does not exist.
+func Open(path string) (*Ledger, error) {
+	l := &Ledger{
+		path:    filepath.Clean(path),
+		entries: make(map[string]Entry),
+	}
+
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		var entries []Entry
+		if err = json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			l.entries[entry.Path] = entry
+		}
+	}
+
+	replayed, err := l.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed {
+		if err = l.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// NewEntry creates entry for a given file. The content hash is counted from the whole file
+// and the file offset is set back to the beginning.
+func NewEntry(file *os.File) (Entry, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return Entry{}, err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{
+		Path:    file.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Processed checks if a file given by entry was already processed with the same content.
+func (l *Ledger) Processed(entry Entry) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e, ok := l.entries[entry.Path]
+
+	return ok && e.Size == entry.Size && e.ModTime.Equal(entry.ModTime) && e.Hash == entry.Hash
+}
+
+// Add adds entry to the ledger and logs it.
+func (l *Ledger) Add(entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries[entry.Path] = entry
+
+	return l.append(change{Entry: entry})
+}
+
+// Remove removes entry for a given path from the ledger and logs it.
+func (l *Ledger) Remove(path string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, ok := l.entries[path]; !ok {
+		return nil
+	}
+
+	delete(l.entries, path)
+
+	return l.append(change{Entry: Entry{Path: path}, Removed: true})
+}
+
+// Close compacts the log into the ledger file.
+func (l *Ledger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.changes == 0 && l.log == nil {
+		return nil
+	}
+
+	return l.compact()
+}
+
+// Entries returns all entries sorted by path.
+func (l *Ledger) Entries() []Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.sorted()
+}
+
+func (l *Ledger) sorted() []Entry {
+	entries := make([]Entry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	return entries
+}
+
+// replay applies logged changes to entries. The last line of the log is ignored when it is not terminated,
+// as when the exporter crashed while writing it. It returns true when the log was not empty.
+func (l *Ledger) replay() (bool, error) {
+	data, err := ioutil.ReadFile(l.path + logSuffix)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for _, line := range lines[:len(lines)-1] { // the last line is empty or incomplete
+		var c change
+		if err = json.Unmarshal(line, &c); err != nil {
+			return false, err
+		}
+
+		if c.Removed {
+			delete(l.entries, c.Path)
+		} else {
+			l.entries[c.Path] = c.Entry
+		}
+	}
+
+	return len(data) > 0, nil
+}
+
+// append appends a change to the log and compacts the log when it has more changes than entries.
+func (l *Ledger) append(c change) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if l.log == nil {
+		l.log, err = os.OpenFile(l.path+logSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err = l.log.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	l.changes++
+
+	if l.changes >= minCompaction && l.changes > len(l.entries) {
+		return l.compact()
+	}
+
+	return nil
+}
+
+// compact saves all entries to the ledger file and removes the log.
+func (l *Ledger) compact() error {
+	if err := l.save(); err != nil {
+		return err
+	}
+
+	if l.log != nil {
+		err := l.log.Close()
+		l.log = nil
+		if err != nil {
+			return err
+		}
+	}
+	l.changes = 0
+
+	if err := os.Remove(l.path + logSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// save writes ledger to a temporary file and renames it, so the ledger is never half-written.
+func (l *Ledger) save() error {
+	data, err := json.MarshalIndent(l.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.path)
+}
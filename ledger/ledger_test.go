@@ -0,0 +1,166 @@
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ledger Suite")
+}
+
+var _ = Describe("Ledger tests", func() {
+	dirPath := "/tmp/goat/ledger-test"
+	ledgerPath := filepath.Join(dirPath, "ledger.json")
+	filePath := filepath.Join(dirPath, "record")
+
+	var (
+		ledger *Ledger
+		entry  Entry
+	)
+
+	BeforeEach(func() {
+		Expect(os.MkdirAll(dirPath, 0700)).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filePath, []byte("data"), 0600)).NotTo(HaveOccurred())
+
+		var err error
+		ledger, err = Open(ledgerPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		file, err := os.Open(filePath)
+		Expect(err).NotTo(HaveOccurred())
+
+		entry, err = NewEntry(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dirPath)).NotTo(HaveOccurred())
+	})
+
+	Describe("creating entry", func() {
+		It("should describe the file", func() {
+			Expect(entry.Path).To(Equal(filePath))
+			Expect(entry.Size).To(Equal(int64(4)))
+			Expect(entry.Hash).To(Equal("3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"))
+		})
+	})
+
+	Describe("checking processed file", func() {
+		Context("when file is not in ledger", func() {
+			It("should not be processed", func() {
+				Expect(ledger.Processed(entry)).To(BeFalse())
+			})
+		})
+
+		Context("when file is in ledger", func() {
+			It("should be processed", func() {
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+				Expect(ledger.Processed(entry)).To(BeTrue())
+			})
+		})
+
+		Context("when file content changed", func() {
+			It("should not be processed", func() {
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+
+				entry.Hash = "changed"
+				Expect(ledger.Processed(entry)).To(BeFalse())
+			})
+		})
+
+		Context("when file was removed from ledger", func() {
+			It("should not be processed", func() {
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+				Expect(ledger.Remove(entry.Path)).NotTo(HaveOccurred())
+				Expect(ledger.Processed(entry)).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("logging changes", func() {
+		Context("when the log has more changes than entries", func() {
+			It("should compact the log into the ledger file", func() {
+				for i := 0; i < minCompaction; i++ {
+					Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+				}
+
+				Expect(ledgerPath).To(BeAnExistingFile())
+				Expect(ledgerPath + logSuffix).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Describe("reopening ledger", func() {
+		Context("when ledger was saved", func() {
+			It("should contain saved entries", func() {
+				entry.Records = 10
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+
+				reopened, err := Open(ledgerPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reopened.Processed(entry)).To(BeTrue())
+				Expect(reopened.Entries()).To(HaveLen(1))
+				Expect(reopened.Entries()[0].Records).To(Equal(10))
+			})
+		})
+
+		Context("when ledger was closed", func() {
+			It("should write entries to the ledger file and remove the log", func() {
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+				Expect(ledgerPath + logSuffix).To(BeAnExistingFile())
+
+				Expect(ledger.Close()).NotTo(HaveOccurred())
+				Expect(ledgerPath + logSuffix).NotTo(BeAnExistingFile())
+
+				reopened, err := Open(ledgerPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reopened.Processed(entry)).To(BeTrue())
+			})
+		})
+
+		Context("when entry was removed", func() {
+			It("should not contain the entry", func() {
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+				Expect(ledger.Remove(entry.Path)).NotTo(HaveOccurred())
+
+				reopened, err := Open(ledgerPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reopened.Entries()).To(BeEmpty())
+			})
+		})
+
+		Context("when the last change was not written completely", func() {
+			It("should ignore the change", func() {
+				Expect(ledger.Add(entry)).NotTo(HaveOccurred())
+
+				log, err := os.OpenFile(ledgerPath+logSuffix, os.O_WRONLY|os.O_APPEND, 0600)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = log.WriteString(`{"path":"other","si`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(log.Close()).NotTo(HaveOccurred())
+
+				reopened, err := Open(ledgerPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reopened.Entries()).To(HaveLen(1))
+				Expect(reopened.Processed(entry)).To(BeTrue())
+			})
+		})
+
+		Context("when ledger is corrupted", func() {
+			It("should return an error", func() {
+				Expect(ioutil.WriteFile(ledgerPath, []byte("{"), 0600)).NotTo(HaveOccurred())
+
+				_, err := Open(ledgerPath)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const namespace = "goat_exporter"
+
+// Failure reasons of file processing.
+const (
+	ReasonOpen    = "open"
+	ReasonRead    = "read"
+	ReasonDetect  = "detect"
+	ReasonUnknown = "unknown_type"
+	ReasonParse   = "parse"
+	ReasonInvalid = "invalid_records"
+)
+
+// Metrics are self-instrumentation metrics of one exporter pipeline. Every pipeline creates its own metrics
+// and registers them to its own registerer.
+type Metrics struct {
+	// FilesSeen counts files taken by parser.
+	FilesSeen *prometheus.CounterVec
+	// FilesParsed counts successfully parsed files.
+	FilesParsed *prometheus.CounterVec
+	// FilesFailed counts files which could not be processed.
+	FilesFailed *prometheus.CounterVec
+	// ParseDuration observes time of parsing files.
+	ParseDuration *prometheus.HistogramVec
+	// RecordProblems counts problems found by validation of records.
+	RecordProblems *prometheus.CounterVec
+	// RecordsRejected counts records rejected by strict validation.
+	RecordsRejected *prometheus.CounterVec
+	// RecordsExported counts records exported to Prometheus.
+	RecordsExported *prometheus.CounterVec
+	// LastExport represents time of the last successful export.
+	LastExport *prometheus.GaugeVec
+	// ExpiredRecords counts records deleted by TTL.
+	ExpiredRecords *prometheus.CounterVec
+}
+
+// New creates self-instrumentation metrics which are not registered yet.
+func New() *Metrics {
+	return &Metrics{
+		FilesSeen: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_seen_total",
+			Help:      "represents the number of files taken by parser.",
+		},
+			[]string{
+				"format",
+				"detector",
+			},
+		),
+
+		FilesParsed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_parsed_total",
+			Help:      "represents the number of successfully parsed files.",
+		},
+			[]string{
+				"format",
+			},
+		),
+
+		FilesFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_failed_total",
+			Help:      "represents the number of files which could not be processed.",
+		},
+			[]string{
+				"format",
+				"reason",
+			},
+		),
+
+		ParseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "parse_duration_seconds",
+			Help:      "represents time of parsing files.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+		},
+			[]string{
+				"format",
+			},
+		),
+
+		RecordProblems: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "record_problems_total",
+			Help:      "represents the number of problems found by validation of records.",
+		},
+			[]string{
+				"format",
+				"reason",
+			},
+		),
+
+		RecordsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_rejected_total",
+			Help:      "represents the number of records rejected by strict validation.",
+		},
+			[]string{
+				"format",
+			},
+		),
+
+		RecordsExported: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_exported_total",
+			Help:      "represents the number of records exported to the Prometheus.",
+		},
+			[]string{
+				"resource",
+			},
+		),
+
+		LastExport: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_export_timestamp_seconds",
+			Help:      "represents time when records were successfully exported to the Prometheus for the last time.",
+		},
+			[]string{
+				"resource",
+			},
+		),
+
+		ExpiredRecords: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "expired_records_total",
+			Help:      "represents the number of records deleted because they were not refreshed for longer than TTL.",
+		},
+			[]string{
+				"resource",
+			},
+		),
+	}
+}
+
+// Register registers self-instrumentation metrics to a given registerer.
+func (m *Metrics) Register(reg prometheus.Registerer) {
+	reg.MustRegister(
+		m.FilesSeen,
+		m.FilesParsed,
+		m.FilesFailed,
+		m.ParseDuration,
+		m.RecordProblems,
+		m.RecordsRejected,
+		m.RecordsExported,
+		m.LastExport,
+		m.ExpiredRecords,
+	)
+
+	logrus.WithField("resource", namespace).Debug("metrics registered")
+}
+
+// RegisterBacklog registers gauge with the number of items waiting in a given channel to a given registerer.
+func RegisterBacklog(reg prometheus.Registerer, channel string, length func() int) {
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "channel_backlog",
+		Help:        "represents the number of items waiting in a channel.",
+		ConstLabels: prometheus.Labels{"channel": channel},
+	}, func() float64 {
+		return float64(length())
+	}))
+}
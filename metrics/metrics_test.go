@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics Suite")
+}
+
+var _ = Describe("Metrics tests", func() {
+	var registry *prometheus.Registry
+
+	BeforeEach(func() {
+		registry = prometheus.NewRegistry()
+	})
+
+	Describe("registering metrics", func() {
+		Context("when metrics are registered", func() {
+			It("should be gathered in goat_exporter namespace", func() {
+				m := New()
+				m.Register(registry)
+				m.FilesFailed.WithLabelValues("vm", ReasonParse).Inc()
+
+				families, err := registry.Gather()
+				Expect(err).NotTo(HaveOccurred())
+
+				var names []string
+				for _, family := range families {
+					names = append(names, family.GetName())
+				}
+				Expect(names).To(ContainElement("goat_exporter_files_failed_total"))
+			})
+		})
+
+		Context("when metrics of two pipelines are registered to two registries", func() {
+			It("should count separately", func() {
+				first, second := New(), New()
+				first.Register(registry)
+				Expect(func() { second.Register(prometheus.NewRegistry()) }).NotTo(Panic())
+
+				first.FilesParsed.WithLabelValues("vm").Inc()
+
+				Expect(testutil.ToFloat64(first.FilesParsed.WithLabelValues("vm"))).To(Equal(1.0))
+				Expect(testutil.ToFloat64(second.FilesParsed.WithLabelValues("vm"))).To(BeZero())
+			})
+		})
+
+		Context("when backlog of channels is registered", func() {
+			It("should gather the number of items waiting in the channels", func() {
+				events := make(chan int, 10)
+				events <- 1
+				events <- 2
+
+				RegisterBacklog(registry, "event", func() int { return len(events) })
+				RegisterBacklog(registry, "record", func() int { return 0 })
+
+				families, err := registry.Gather()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(families).To(HaveLen(1))
+
+				backlog := make(map[string]float64)
+				for _, m := range families[0].GetMetric() {
+					backlog[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+				}
+				Expect(backlog).To(Equal(map[string]float64{"event": 2, "record": 0}))
+			})
+		})
+	})
+})
@@ -1,22 +1,121 @@
 package parse
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"strings"
 
 	"github.com/goat-project/exporter/record"
 )
 
 // IPRecords parses data from JSON format to IPs.
 func IPRecords(file io.Reader) (record.IPs, error) {
-	data, err := ioutil.ReadAll(file)
+	var ips record.IPs
+
+	err := StreamIPRecords(file, 0, nil, func(batch record.IPs) {
+		ips.Ips = append(ips.Ips, batch.Ips...)
+	})
 	if err != nil {
 		return record.IPs{}, err
 	}
 
-	var ipRecords record.IPs
-	err = json.Unmarshal(data, &ipRecords)
+	return ips, nil
+}
+
+// StreamIPRecords decodes data from JSON format token by token and emits IP records
+// in batches of at most batchSize records. Zero batchSize means all records in one batch.
+// Problems of records are collected to report, records rejected by report are not emitted.
+// Line numbers of problems are unknown.
+func StreamIPRecords(file io.Reader, batchSize int, report *Report, emit func(record.IPs)) error {
+	reader := bufio.NewReader(file)
+	if err := skipBOM(reader); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(reader)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	var ips record.IPs
+
+	index := 0
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if key, ok := t.(string); !ok || !strings.EqualFold(key, "Ips") {
+			var value json.RawMessage
+			if err = dec.Decode(&value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if t, err = dec.Token(); err != nil {
+			return err
+		}
+		if t == nil {
+			continue // "Ips": null
+		}
+		if t != json.Delim('[') {
+			return fmt.Errorf("unexpected %v, expected array of IP records", t)
+		}
+
+		for dec.More() {
+			var ip record.IP
+			if err = dec.Decode(&ip); err != nil {
+				return err
+			}
+
+			index++
+			if !report.check(index, validateIP(ip, 0)) {
+				continue
+			}
+
+			ips.Ips = append(ips.Ips, ip)
+			if batchSize > 0 && len(ips.Ips) >= batchSize {
+				emit(ips)
+				ips = record.IPs{}
+			}
+		}
+
+		if err = expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after JSON object")
+	}
+
+	if len(ips.Ips) > 0 {
+		emit(ips)
+	}
+
+	return nil
+}
+
+// expectDelim reads the next token and checks if it is a given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if t != delim {
+		return fmt.Errorf("unexpected %v, expected %v", t, delim)
+	}
 
-	return ipRecords, err
+	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/goat-project/exporter/record"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -182,4 +184,22 @@ var _ = Describe("IP record parser tests", func() {
 			})
 		})
 	})
+
+	Describe("streaming file", func() {
+		Context("when batch size is smaller than the number of records", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctJSON_20"
+			})
+
+			It("should emit records in batches", func() {
+				var sizes []int
+				err := StreamIPRecords(file, 7, nil, func(batch record.IPs) {
+					sizes = append(sizes, len(batch.Ips))
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sizes).To(Equal([]int{7, 7, 6}))
+			})
+		})
+	})
 })
@@ -0,0 +1,187 @@
+package parse
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/goat-project/exporter/record"
+)
+
+// starNamespace is the namespace of EMI StAR (Storage Accounting Record) elements.
+const starNamespace = "http://eu-emi.eu/namespaces/2011/02/storagerecord"
+
+// starRecord represents sr:StorageUsageRecord element. Elements and attributes are matched
+// by local names, so records with unqualified attributes are accepted too.
+type starRecord struct {
+	RecordIdentity struct {
+		RecordID   string    `xml:"recordId,attr"`
+		CreateTime time.Time `xml:"createTime,attr"`
+	} `xml:"RecordIdentity"`
+	StorageSystem   string  `xml:"StorageSystem"`
+	Site            *string `xml:"Site"`
+	StorageShare    *string `xml:"StorageShare"`
+	StorageMedia    *string `xml:"StorageMedia"`
+	StorageClass    *string `xml:"StorageClass"`
+	FileCount       *string `xml:"FileCount"`
+	DirectoryPath   *string `xml:"DirectoryPath"`
+	SubjectIdentity struct {
+		LocalUser      *string `xml:"LocalUser"`
+		LocalGroup     *string `xml:"LocalGroup"`
+		UserIdentity   *string `xml:"UserIdentity"`
+		Group          *string `xml:"Group"`
+		GroupAttribute []struct {
+			Type  string `xml:"attributeType,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"GroupAttribute"`
+	} `xml:"SubjectIdentity"`
+	StartTime                 time.Time `xml:"StartTime"`
+	EndTime                   time.Time `xml:"EndTime"`
+	ResourceCapacityUsed      uint64    `xml:"ResourceCapacityUsed"`
+	LogicalCapacityUsed       *uint64   `xml:"LogicalCapacityUsed"`
+	ResourceCapacityAllocated *uint64   `xml:"ResourceCapacityAllocated"`
+}
+
+// storage maps StAR record starting at a given line to storage record and returns problems of values which
+// are not mapped. Only the first group attribute is mapped.
+func (r starRecord) storage(line int) (record.Storage, []Problem) {
+	storage := record.Storage{
+		RecordID:                  r.RecordIdentity.RecordID,
+		CreateTime:                r.RecordIdentity.CreateTime,
+		StorageSystem:             r.StorageSystem,
+		Site:                      r.Site,
+		StorageShare:              r.StorageShare,
+		StorageMedia:              r.StorageMedia,
+		StorageClass:              r.StorageClass,
+		DirectoryPath:             r.DirectoryPath,
+		LocalUser:                 r.SubjectIdentity.LocalUser,
+		LocalGroup:                r.SubjectIdentity.LocalGroup,
+		UserIdentity:              r.SubjectIdentity.UserIdentity,
+		Group:                     r.SubjectIdentity.Group,
+		StartTime:                 r.StartTime,
+		EndTime:                   r.EndTime,
+		ResourceCapacityUsed:      r.ResourceCapacityUsed,
+		LogicalCapacityUsed:       r.LogicalCapacityUsed,
+		ResourceCapacityAllocated: r.ResourceCapacityAllocated,
+	}
+
+	if len(r.SubjectIdentity.GroupAttribute) > 0 {
+		attribute := r.SubjectIdentity.GroupAttribute[0]
+		storage.GroupAttribute = &attribute.Value
+		storage.GroupAttributeType = &attribute.Type
+	}
+
+	var problems []Problem
+	storage.FileCount, problems = fileCount(r.FileCount, line)
+
+	return storage, problems
+}
+
+// StARRecords parses data from EMI StAR XML format to storage record.
+func StARRecords(file io.Reader) (record.Storages, error) {
+	var storages record.Storages
+
+	err := StreamStARRecords(file, 0, nil, func(batch record.Storages) {
+		storages.Storages = append(storages.Storages, batch.Storages...)
+	})
+	if err != nil {
+		return record.Storages{}, err
+	}
+
+	return storages, nil
+}
+
+// StreamStARRecords decodes data from EMI StAR XML format token by token and emits storage records
+// in batches of at most batchSize records. Zero batchSize means all records in one batch.
+// The root element is either sr:StorageUsageRecords wrapping the records or a single sr:StorageUsageRecord.
+// Problems of records are collected to report, records rejected by report are not emitted.
+func StreamStARRecords(file io.Reader, batchSize int, report *Report, emit func(record.Storages)) error {
+	reader := bufio.NewReader(file)
+	if err := skipBOM(reader); err != nil {
+		return err
+	}
+
+	counter := &lineCounter{reader: reader}
+	dec := xml.NewDecoder(counter)
+
+	root, err := rootElement(dec)
+	if err != nil {
+		return err
+	}
+
+	if !starRoot(root.Name) {
+		return fmt.Errorf("expected element type <StorageUsageRecords> in namespace %s but have <%s> in namespace %s",
+			starNamespace, root.Name.Local, root.Name.Space)
+	}
+
+	if root.Name.Local == "StorageUsageRecord" {
+		line := counter.lineAt(dec.InputOffset())
+
+		var r starRecord
+		if err = dec.DecodeElement(&r, &root); err != nil {
+			return err
+		}
+
+		storage, problems := r.storage(line)
+		if report.check(1, append(problems, validateStorage(storage, line)...)) {
+			emit(record.Storages{Storages: []record.Storage{storage}})
+		}
+
+		return nil
+	}
+
+	var storages record.Storages
+
+	index := 0
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			if e.Name.Local != "StorageUsageRecord" {
+				if err = dec.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			line := counter.lineAt(dec.InputOffset())
+
+			var r starRecord
+			if err = dec.DecodeElement(&r, &e); err != nil {
+				return err
+			}
+
+			storage, problems := r.storage(line)
+
+			index++
+			if !report.check(index, append(problems, validateStorage(storage, line)...)) {
+				continue
+			}
+
+			storages.Storages = append(storages.Storages, storage)
+			if batchSize > 0 && len(storages.Storages) >= batchSize {
+				emit(storages)
+				storages = record.Storages{}
+			}
+		case xml.EndElement: // end of StorageUsageRecords
+			if len(storages.Storages) > 0 {
+				emit(storages)
+			}
+
+			return nil
+		}
+	}
+}
+
+// starRoot checks whether name is a root element of StAR document.
+func starRoot(name xml.Name) bool {
+	return name.Space == starNamespace &&
+		(name.Local == "StorageUsageRecords" || name.Local == "StorageUsageRecord")
+}
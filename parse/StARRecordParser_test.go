@@ -0,0 +1,137 @@
+package parse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goat-project/exporter/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//  Tests:
+//  correct StAR file					x
+//  single record						x
+//  wrong namespace						x
+//  Goat storage XML					x
+//  streaming							x
+
+var _ = Describe("StAR record parser tests", func() {
+	dirPath := "test-data/star/"
+
+	var (
+		err      error
+		file     *os.File
+		fileName string
+	)
+
+	JustBeforeEach(func() {
+		_, err = os.Stat(filepath.Join(dirPath, filepath.Clean(fileName)))
+		Expect(err).NotTo(HaveOccurred())
+
+		file, err = os.Open(filepath.Join(dirPath, filepath.Clean(fileName)))
+		if err != nil {
+			fmt.Println("error open file:", err)
+		}
+	})
+
+	AfterEach(func() {
+		err = file.Close()
+		if err != nil {
+			fmt.Println("error close file:", err, file.Name())
+		}
+	})
+
+	Describe("parsing file", func() {
+		Context("when file is correct", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctStAR_3"
+			})
+
+			It("should map records to storage records", func() {
+				data, err := StARRecords(file)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(data.Storages)).To(Equal(3))
+
+				storage := data.Storages[0]
+				Expect(storage.RecordID).To(Equal("host.example.org/sr/87912469269276"))
+				Expect(storage.CreateTime).To(Equal(time.Date(2020, 1, 8, 11, 56, 35, 0, time.UTC)))
+				Expect(storage.StorageSystem).To(Equal("host.example.org"))
+				Expect(*storage.Site).To(Equal("goat-st-site-name"))
+				Expect(*storage.StorageShare).To(Equal("pool-003"))
+				Expect(*storage.LocalUser).To(Equal("johndoe"))
+				Expect(*storage.Group).To(Equal("binarydataproject.example.org"))
+				Expect(*storage.GroupAttribute).To(Equal("ukusers"))
+				Expect(*storage.GroupAttributeType).To(Equal("subgroup"))
+				Expect(storage.ResourceCapacityUsed).To(Equal(uint64(14728)))
+				Expect(*storage.LogicalCapacityUsed).To(Equal(uint64(13617)))
+				Expect(*storage.ResourceCapacityAllocated).To(Equal(uint64(14624)))
+
+				Expect(data.Storages[1].LocalUser).To(BeNil())
+				Expect(data.Storages[1].GroupAttribute).To(BeNil())
+				Expect(data.Storages[2].RecordID).To(Equal("host.example.org/sr/87912469269278"))
+			})
+		})
+
+		Context("when file contains a single record", func() {
+			BeforeEach(func() {
+				fileName = "0001_single_record"
+			})
+
+			It("should not return an error", func() {
+				data, err := StARRecords(file)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(data.Storages)).To(Equal(1))
+			})
+		})
+
+		Context("when namespace is wrong", func() {
+			BeforeEach(func() {
+				fileName = "0002_wrong_namespace"
+			})
+
+			It("should return an error", func() {
+				data, err := StARRecords(file)
+
+				Expect(err).To(HaveOccurred())
+				Expect(len(data.Storages)).To(Equal(0))
+			})
+		})
+
+		Context("when file is Goat storage XML", func() {
+			BeforeEach(func() {
+				fileName = "0003_STORAGES"
+			})
+
+			It("should return an error", func() {
+				data, err := StARRecords(file)
+
+				Expect(err).To(HaveOccurred())
+				Expect(len(data.Storages)).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("streaming file", func() {
+		Context("when batch size is smaller than the number of records", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctStAR_3"
+			})
+
+			It("should emit records in batches", func() {
+				var sizes []int
+				err := StreamStARRecords(file, 2, nil, func(batch record.Storages) {
+					sizes = append(sizes, len(batch.Storages))
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sizes).To(Equal([]int{2, 1}))
+			})
+		})
+	})
+})
@@ -1,22 +1,116 @@
 package parse
 
 import (
+	"bufio"
 	"encoding/xml"
+	"fmt"
 	"io"
-	"io/ioutil"
 
 	"github.com/goat-project/exporter/record"
 )
 
+// storageElement represents STORAGE element. The number of files is parsed after the element is decoded,
+// so an invalid number is a problem of the record instead of an error of the whole file.
+type storageElement struct {
+	record.Storage
+	FileCount *string `xml:"FILE_COUNT"`
+}
+
 // StorageRecords parses data from XML format to storage record.
 func StorageRecords(file io.Reader) (record.Storages, error) {
-	data, err := ioutil.ReadAll(file)
+	var storages record.Storages
+
+	err := StreamStorageRecords(file, 0, nil, func(batch record.Storages) {
+		storages.Storages = append(storages.Storages, batch.Storages...)
+	})
 	if err != nil {
 		return record.Storages{}, err
 	}
 
-	var stRecords record.Storages
-	err = xml.Unmarshal(data, &stRecords)
+	return storages, nil
+}
+
+// StreamStorageRecords decodes data from XML format token by token and emits storage records
+// in batches of at most batchSize records. Zero batchSize means all records in one batch.
+// Problems of records are collected to report, records rejected by report are not emitted.
+func StreamStorageRecords(file io.Reader, batchSize int, report *Report, emit func(record.Storages)) error {
+	reader := bufio.NewReader(file)
+	if err := skipBOM(reader); err != nil {
+		return err
+	}
+
+	counter := &lineCounter{reader: reader}
+	dec := xml.NewDecoder(counter)
+
+	root, err := rootElement(dec)
+	if err != nil {
+		return err
+	}
+
+	if root.Name.Local != "STORAGES" {
+		return fmt.Errorf("expected element type <STORAGES> but have <%s>", root.Name.Local)
+	}
+
+	var storages record.Storages
 
-	return stRecords, err
+	index := 0
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			if e.Name.Local != "STORAGE" {
+				if err = dec.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			line := counter.lineAt(dec.InputOffset())
+
+			var element storageElement
+			if err = dec.DecodeElement(&element, &e); err != nil {
+				return err
+			}
+
+			storage := element.Storage
+			var problems []Problem
+			storage.FileCount, problems = fileCount(element.FileCount, line)
+
+			index++
+			if !report.check(index, append(problems, validateStorage(storage, line)...)) {
+				continue
+			}
+
+			storages.Storages = append(storages.Storages, storage)
+			if batchSize > 0 && len(storages.Storages) >= batchSize {
+				emit(storages)
+				storages = record.Storages{}
+			}
+		case xml.EndElement: // end of STORAGES
+			if len(storages.Storages) > 0 {
+				emit(storages)
+			}
+
+			return nil
+		}
+	}
+}
+
+// rootElement reads tokens until the root element starts.
+func rootElement(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		if start, ok := t.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
 }
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/goat-project/exporter/record"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -23,6 +25,7 @@ import (
 //         - unknown content			x
 //         - empty						x
 //         - wrong XML format			x
+//         - invalid number of files	x
 
 var _ = Describe("Storage record parser tests", func() {
 	dirPath := "test-data/st/"
@@ -183,4 +186,60 @@ var _ = Describe("Storage record parser tests", func() {
 			})
 		})
 	})
+
+	Describe("parsing number of files", func() {
+		Context("when number of files is valid", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctXML_10"
+			})
+
+			It("should parse it", func() {
+				storages, err := StorageRecords(file)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(storages.Storages[0].FileCount).NotTo(BeNil())
+				Expect(*storages.Storages[0].FileCount).To(Equal(uint64(1)))
+			})
+		})
+
+		Context("when number of files is invalid", func() {
+			BeforeEach(func() {
+				fileName = "0010_invalid_FILE_COUNT"
+			})
+
+			It("should report a problem and not set it", func() {
+				report := Validation{Mode: ModeWarn, Reject: RejectFile}.Report()
+
+				var storages []record.Storage
+				err := StreamStorageRecords(file, 0, report, func(batch record.Storages) {
+					storages = append(storages, batch.Storages...)
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(storages).To(HaveLen(1))
+				Expect(storages[0].FileCount).To(BeNil())
+				Expect(report.Problems).To(HaveLen(1))
+				Expect(report.Problems[0].Field).To(Equal("FileCount"))
+				Expect(report.Problems[0].Reason).To(Equal(ReasonInvalid))
+				Expect(report.Problems[0].Line).To(Equal(4))
+			})
+		})
+	})
+
+	Describe("streaming file", func() {
+		Context("when batch size is smaller than the number of records", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctXML_10"
+			})
+
+			It("should emit records in batches", func() {
+				var sizes []int
+				err := StreamStorageRecords(file, 3, nil, func(batch record.Storages) {
+					sizes = append(sizes, len(batch.Storages))
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sizes).To(Equal([]int{3, 3, 3, 1}))
+			})
+		})
+	})
 })
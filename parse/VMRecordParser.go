@@ -2,105 +2,99 @@ package parse
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"strings"
 
-	"github.com/goat-project/exporter/utils"
 	"github.com/sirupsen/logrus"
 
 	"github.com/goat-project/exporter/record"
 )
 
-const (
-	apelVersion = "0.4"
-	apelMessage = "APEL-cloud-message: v" + apelVersion
-)
+const apelHeader = "APEL-cloud-message:"
 
 // VMRecords parses data from template to vm/server record.
 func VMRecords(file io.Reader) (record.VMs, error) {
+	var vms record.VMs
+
+	err := StreamVMRecords(file, 0, nil, func(batch record.VMs) {
+		vms.VMs = append(vms.VMs, batch.VMs...)
+	})
+	if err != nil {
+		return record.VMs{}, err
+	}
+
+	return vms, nil
+}
+
+// StreamVMRecords parses data from template record by record and emits vm/server records
+// in batches of at most batchSize records. Zero batchSize means all records in one batch.
+// Problems of records are collected to report, records rejected by report are not emitted.
+func StreamVMRecords(file io.Reader, batchSize int, report *Report, emit func(record.VMs)) error {
 	// create reader
 	reader := bufio.NewReader(file)
+	if err := skipBOM(reader); err != nil {
+		return err
+	}
 
-	// check APEL format
-	if !apelFormat(reader) {
-		return record.VMs{}, fmt.Errorf("not APEL format")
+	// check APEL format and version
+	version, err := apelVersion(reader)
+	if err != nil {
+		return err
 	}
+	schema := apelSchemas[version]
 
 	// create VMs structure
 	var vms record.VMs
 
+	index := 0
+	line := 2 // the first line is APEL header
+
 	for {
 		// read vm (or %)
 		vmb, err := reader.ReadString('%')
+		start := line
+		line += strings.Count(vmb, "\n")
 		if err != nil {
+			if strings.TrimSpace(vmb) != "" {
+				index++
+				report.check(index, []Problem{{Line: start, Reason: ReasonUnterminated}})
+			}
 			break // EOF
 		}
 		if vmb == "%" {
 			continue
 		}
-		if vmb == "" {
-			continue
-		}
 
-		// split vm lines
-		lines := strings.Split(vmb, "\n")
-		if len(lines) == 0 {
+		index++
+
+		vm, problems := apelVM(schema, strings.TrimSuffix(vmb, "%"), start)
+		if !report.check(index, problems) {
 			continue
 		}
 
-		// create vm map
-		vmm := make(map[string]string)
+		// save vm to VMs structure
+		vms.VMs = append(vms.VMs, vm)
 
-		// split line to save vm parts
-		for _, line := range lines {
-			part := strings.Split(line, ": ")
-			if len(part) == 2 {
-				vmm[part[0]] = part[1]
-			}
+		if batchSize > 0 && len(vms.VMs) >= batchSize {
+			emit(vms)
+			vms = record.VMs{}
 		}
+	}
 
-		// save vm to VMs structure
-		vms.VMs = append(vms.VMs, record.VM{
-			VMUUID:              vmm["VMUUID"],
-			SiteName:            vmm["SiteName"],
-			CloudComputeService: utils.String(vmm["CloudComputeService"]),
-			MachineName:         vmm["MachineName"],
-			LocalUserID:         utils.String(vmm["LocalUserId"]),
-			LocalGroupID:        utils.String(vmm["LocalGroupId"]),
-			GlobalUserName:      utils.String(vmm["GlobalUserName"]),
-			Fqan:                utils.String(vmm["FQAN"]),
-			Status:              utils.String(vmm["Status"]),
-			StartTime:           utils.String(vmm["StartTime"]),
-			EndTime:             utils.String(vmm["EndTime"]),
-			SuspendDuration:     utils.String(vmm["SuspendDuration"]),
-			WallDuration:        utils.String(vmm["WallDuration"]),
-			CPUDuration:         utils.String(vmm["CpuDuration"]),
-			CPUCount:            utils.StrToUint32(vmm["CpuCount"]),
-			NetworkType:         utils.String(vmm["NetworkType"]),
-			NetworkInbound:      utils.StrToUint64(vmm["NetworkInbound"]),
-			NetworkOutbound:     utils.StrToUint64(vmm["NetworkOutbound"]),
-			PublicIPCount:       utils.StrToUint64(vmm["PublicIPCount"]),
-			Memory:              utils.StrToUint64(vmm["Memory"]),
-			Disk:                utils.StrToUint64(vmm["Disk"]),
-			StorageRecordID:     utils.String(vmm["StorageRecordId"]),
-			ImageID:             utils.String(vmm["ImageId"]),
-			CloudType:           utils.String(vmm["CloudType"]),
-			BenchmarkType:       utils.String(vmm["BenchmarkType"]),
-			Benchmark:           utils.StrToFloat32(vmm["Benchmark"]),
-		})
+	if len(vms.VMs) > 0 {
+		emit(vms)
 	}
 
-	return vms, nil
+	return nil
 }
 
-// apelFormat reads line from reader and checks message.
-func apelFormat(reader *bufio.Reader) bool {
+// apelVersion reads line from reader and returns version of APEL message.
+func apelVersion(reader *bufio.Reader) (string, error) {
 	line, err := reader.ReadString('\n')
 	if err != nil {
 		logrus.WithField("error", err).Error("unable to read first line")
-		return false
+		return "", err
 	}
 
-	return line == apelMessage+"\n"
+	return parseAPELHeader(line)
 }
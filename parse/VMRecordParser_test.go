@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/goat-project/exporter/record"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,6 +30,17 @@ import (
 // 		   - missing colon :			x
 // 		   - missing name				x
 // 		   - missing %%					x
+//  APEL version:
+//         - v0.2						x
+//         - v0.5						x
+//         - unsupported				x
+//  typed values:
+//         - time and duration			x
+//         - invalid time and duration	x
+//  validation:
+//         - warn						x
+//         - strict						x
+//         - unterminated record		x
 
 var _ = Describe("VM record parser tests", func() {
 	dirPath := "test-data/vm/"
@@ -241,4 +255,178 @@ var _ = Describe("VM record parser tests", func() {
 			})
 		})
 	})
+
+	Describe("APEL version", func() {
+		Context("when version is v0.2", func() {
+			BeforeEach(func() {
+				fileName = "0014_APEL_v02"
+			})
+
+			It("should map only v0.2 fields", func() {
+				data, err := VMRecords(file)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(data.VMs)).To(Equal(1))
+				Expect(data.VMs[0].CPUCount).To(Equal(uint32(2)))
+				Expect(data.VMs[0].PublicIPCount).To(BeNil()) // added in v0.4
+			})
+		})
+
+		Context("when version is v0.5", func() {
+			BeforeEach(func() {
+				fileName = "0015_APEL_v05"
+			})
+
+			It("should map accelerator fields", func() {
+				data, err := VMRecords(file)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(data.VMs)).To(Equal(1))
+				Expect(*data.VMs[0].PublicIPCount).To(Equal(uint64(1)))
+				Expect(*data.VMs[0].AcceleratorCount).To(Equal(uint64(2)))
+				Expect(*data.VMs[0].AcceleratorType).To(Equal("GPU"))
+			})
+		})
+
+		Context("when version is not supported", func() {
+			BeforeEach(func() {
+				fileName = "0016_unsupported_APEL_version"
+			})
+
+			It("should return an error", func() {
+				data, err := VMRecords(file)
+
+				Expect(err).To(HaveOccurred())
+				Expect(len(data.VMs)).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("typed values", func() {
+		Context("when time and duration are correct", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctAPEL_10"
+			})
+
+			It("should parse time and duration", func() {
+				data, err := VMRecords(file)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(data.VMs[0].StartTime.Equal(time.Unix(1578317745, 0))).To(BeTrue())
+				Expect(data.VMs[0].EndTime.Equal(time.Unix(1578327156, 0))).To(BeTrue())
+				Expect(*data.VMs[0].SuspendDuration).To(Equal(-7698194 * time.Second))
+				Expect(*data.VMs[0].WallDuration).To(Equal(7707605 * time.Second))
+				Expect(*data.VMs[0].CPUDuration).To(Equal(7707605 * time.Second))
+			})
+		})
+
+		Context("when time and duration are not in seconds", func() {
+			BeforeEach(func() {
+				fileName = "0018_invalid_time"
+			})
+
+			It("should report invalid values", func() {
+				report := Validation{Mode: ModeWarn, Reject: RejectFile}.Report()
+
+				var vms []record.VM
+				err := StreamVMRecords(file, 0, report, func(batch record.VMs) {
+					vms = append(vms, batch.VMs...)
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(vms).To(HaveLen(1))
+				Expect(vms[0].StartTime).To(BeNil())
+				Expect(vms[0].WallDuration).To(BeNil())
+				Expect(report.Problems).To(HaveLen(2))
+				Expect(report.Problems[0].Field).To(Equal("StartTime"))
+				Expect(report.Problems[0].Line).To(Equal(12))
+				Expect(report.Problems[0].Reason).To(Equal(ReasonInvalid))
+				Expect(report.Problems[1].Field).To(Equal("WallDuration"))
+			})
+		})
+	})
+
+	Describe("validation", func() {
+		var report *Report
+
+		Context("when line is malformed and mode is warn", func() {
+			BeforeEach(func() {
+				fileName = "0011_missing_colon"
+				report = Validation{Mode: ModeWarn, Reject: RejectFile}.Report()
+			})
+
+			It("should report problems and keep the record", func() {
+				var vms []record.VM
+				err := StreamVMRecords(file, 0, report, func(batch record.VMs) {
+					vms = append(vms, batch.VMs...)
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(vms).To(HaveLen(1))
+				Expect(report.Problems).To(Equal([]Problem{
+					{Record: 1, Line: 4, Reason: ReasonMalformed},
+					{Record: 1, Line: 3, Field: "SiteName", Reason: ReasonMissing},
+				}))
+				Expect(report.err()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when values are invalid and mode is strict", func() {
+			BeforeEach(func() {
+				fileName = "0017_invalid_values"
+				report = Validation{Mode: ModeStrict, Reject: RejectRecord}.Report()
+			})
+
+			It("should reject the record", func() {
+				var vms []record.VM
+				err := StreamVMRecords(file, 0, report, func(batch record.VMs) {
+					vms = append(vms, batch.VMs...)
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(vms).To(HaveLen(1))
+				Expect(report.Rejected).To(Equal(1))
+				Expect(report.Problems).To(HaveLen(2))
+				Expect(report.Problems[0].Record).To(Equal(2))
+				Expect(report.Problems[0].Line).To(Equal(45))
+				Expect(report.Problems[0].Field).To(Equal("CpuCount"))
+				Expect(report.Problems[0].Reason).To(Equal(ReasonInvalid))
+				Expect(report.Problems[1].Line).To(Equal(50))
+				Expect(report.err()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when record is not terminated and mode is strict", func() {
+			BeforeEach(func() {
+				fileName = "0012_missing_percent_symbol"
+				report = Validation{Mode: ModeStrict, Reject: RejectFile}.Report()
+			})
+
+			It("should reject the file", func() {
+				err := StreamVMRecords(file, 0, report, func(batch record.VMs) {})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.Problems).To(Equal([]Problem{{Record: 1, Line: 2, Reason: ReasonUnterminated}}))
+				Expect(report.err()).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("streaming file", func() {
+		Context("when batch size is smaller than the number of records", func() {
+			BeforeEach(func() {
+				fileName = "0000_correctAPEL_10"
+			})
+
+			It("should emit records in batches", func() {
+				var sizes []int
+				err := StreamVMRecords(file, 4, nil, func(batch record.VMs) {
+					sizes = append(sizes, len(batch.VMs))
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sizes).To(Equal([]int{4, 4, 2}))
+			})
+		})
+	})
 })
@@ -0,0 +1,198 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goat-project/exporter/record"
+	"github.com/goat-project/exporter/utils"
+)
+
+// APEL cloud message versions.
+const (
+	APELv02 = "0.2"
+	APELv04 = "0.4"
+	APELv05 = "0.5"
+)
+
+// apelField sets a value of an APEL message field to vm/server record.
+// It returns an error when the value cannot be converted.
+type apelField func(vm *record.VM, value string) error
+
+// apelFieldsV02 are fields of APEL cloud message v0.2.
+var apelFieldsV02 = map[string]apelField{
+	"VMUUID":          text(func(vm *record.VM, v string) { vm.VMUUID = v }),
+	"SiteName":        text(func(vm *record.VM, v string) { vm.SiteName = v }),
+	"MachineName":     text(func(vm *record.VM, v string) { vm.MachineName = v }),
+	"LocalUserId":     str(func(vm *record.VM, v *string) { vm.LocalUserID = v }),
+	"LocalGroupId":    str(func(vm *record.VM, v *string) { vm.LocalGroupID = v }),
+	"GlobalUserName":  str(func(vm *record.VM, v *string) { vm.GlobalUserName = v }),
+	"FQAN":            str(func(vm *record.VM, v *string) { vm.Fqan = v }),
+	"Status":          str(func(vm *record.VM, v *string) { vm.Status = v }),
+	"StartTime":       timeField(func(vm *record.VM, v *time.Time) { vm.StartTime = v }),
+	"EndTime":         timeField(func(vm *record.VM, v *time.Time) { vm.EndTime = v }),
+	"SuspendDuration": durationField(func(vm *record.VM, v *time.Duration) { vm.SuspendDuration = v }),
+	"WallDuration":    durationField(func(vm *record.VM, v *time.Duration) { vm.WallDuration = v }),
+	"CpuDuration":     durationField(func(vm *record.VM, v *time.Duration) { vm.CPUDuration = v }),
+	"CpuCount":        uint32Field(func(vm *record.VM, v uint32) { vm.CPUCount = v }),
+	"NetworkType":     str(func(vm *record.VM, v *string) { vm.NetworkType = v }),
+	"NetworkInbound":  uint64Field(func(vm *record.VM, v *uint64) { vm.NetworkInbound = v }),
+	"NetworkOutbound": uint64Field(func(vm *record.VM, v *uint64) { vm.NetworkOutbound = v }),
+	"Memory":          uint64Field(func(vm *record.VM, v *uint64) { vm.Memory = v }),
+	"Disk":            uint64Field(func(vm *record.VM, v *uint64) { vm.Disk = v }),
+	"StorageRecordId": str(func(vm *record.VM, v *string) { vm.StorageRecordID = v }),
+	"ImageId":         str(func(vm *record.VM, v *string) { vm.ImageID = v }),
+	"CloudType":       str(func(vm *record.VM, v *string) { vm.CloudType = v }),
+}
+
+// apelFieldsV04 are fields added in APEL cloud message v0.4.
+var apelFieldsV04 = map[string]apelField{
+	"CloudComputeService": str(func(vm *record.VM, v *string) { vm.CloudComputeService = v }),
+	"PublicIPCount":       uint64Field(func(vm *record.VM, v *uint64) { vm.PublicIPCount = v }),
+	"BenchmarkType":       str(func(vm *record.VM, v *string) { vm.BenchmarkType = v }),
+	"Benchmark":           float32Field(func(vm *record.VM, v *float32) { vm.Benchmark = v }),
+}
+
+// apelFieldsV05 are fields added in APEL cloud message v0.5.
+var apelFieldsV05 = map[string]apelField{
+	"AcceleratorCount": uint64Field(func(vm *record.VM, v *uint64) { vm.AcceleratorCount = v }),
+	"AcceleratorType":  str(func(vm *record.VM, v *string) { vm.AcceleratorType = v }),
+}
+
+// apelSchemas maps APEL cloud message versions to their fields. Each version contains
+// fields of the previous one.
+var apelSchemas = map[string]map[string]apelField{
+	APELv02: apelFieldsV02,
+	APELv04: mergeFields(apelFieldsV02, apelFieldsV04),
+	APELv05: mergeFields(apelFieldsV02, apelFieldsV04, apelFieldsV05),
+}
+
+// parseAPELHeader returns version of APEL cloud message from its header line.
+func parseAPELHeader(line string) (string, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, apelHeader) {
+		return "", fmt.Errorf("not APEL format")
+	}
+
+	version := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, apelHeader)), "v")
+	if _, ok := apelSchemas[version]; !ok {
+		return "", fmt.Errorf("unsupported APEL version: %s", version)
+	}
+
+	return version, nil
+}
+
+// apelVM creates vm/server record from lines of APEL message record starting at a given line
+// of the file. It returns problems of the record, malformed lines and fields unknown in the version are skipped.
+func apelVM(schema map[string]apelField, text string, start int) (record.VM, []Problem) {
+	var (
+		vm       record.VM
+		problems []Problem
+		first    int
+	)
+
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if first == 0 {
+			first = start + i
+		}
+
+		part := strings.Split(line, ": ")
+		if len(part) != 2 {
+			problems = append(problems, Problem{Line: start + i, Reason: ReasonMalformed})
+			continue
+		}
+
+		set, ok := schema[part[0]]
+		if !ok {
+			problems = append(problems, Problem{Line: start + i, Field: part[0], Reason: ReasonUnknownField})
+			continue
+		}
+
+		if err := set(&vm, part[1]); err != nil {
+			problems = append(problems, Problem{Line: start + i, Field: part[0], Reason: ReasonInvalid,
+				Detail: err.Error()})
+		}
+	}
+
+	if first == 0 {
+		first = start
+	}
+
+	return vm, append(problems, validateVM(vm, first)...)
+}
+
+// text creates field of a string value.
+func text(set func(vm *record.VM, value string)) apelField {
+	return func(vm *record.VM, value string) error {
+		set(vm, value)
+		return nil
+	}
+}
+
+// str creates field of an optional string value.
+func str(set func(vm *record.VM, value *string)) apelField {
+	return func(vm *record.VM, value string) error {
+		set(vm, utils.String(value))
+		return nil
+	}
+}
+
+// uint32Field creates field of an unsigned integer value.
+func uint32Field(set func(vm *record.VM, value uint32)) apelField {
+	return func(vm *record.VM, value string) error {
+		u, err := utils.ParseUint32(value)
+		set(vm, u)
+		return err
+	}
+}
+
+// uint64Field creates field of an optional unsigned integer value.
+func uint64Field(set func(vm *record.VM, value *uint64)) apelField {
+	return func(vm *record.VM, value string) error {
+		u, err := utils.ParseUint64(value)
+		set(vm, u)
+		return err
+	}
+}
+
+// float32Field creates field of an optional float value.
+func float32Field(set func(vm *record.VM, value *float32)) apelField {
+	return func(vm *record.VM, value string) error {
+		f, err := utils.ParseFloat32(value)
+		set(vm, f)
+		return err
+	}
+}
+
+// timeField creates field of an optional time value given in seconds since epoch.
+func timeField(set func(vm *record.VM, value *time.Time)) apelField {
+	return func(vm *record.VM, value string) error {
+		t, err := utils.ParseUnixTime(value)
+		set(vm, t)
+		return err
+	}
+}
+
+// durationField creates field of an optional duration value given in seconds.
+func durationField(set func(vm *record.VM, value *time.Duration)) apelField {
+	return func(vm *record.VM, value string) error {
+		d, err := utils.ParseSeconds(value)
+		set(vm, d)
+		return err
+	}
+}
+
+func mergeFields(fields ...map[string]apelField) map[string]apelField {
+	merged := make(map[string]apelField)
+	for _, f := range fields {
+		for key, set := range f {
+			merged[key] = set
+		}
+	}
+
+	return merged
+}
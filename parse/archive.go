@@ -0,0 +1,97 @@
+package parse
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	tarMagic  = []byte("ustar")
+)
+
+// tarMagicOffset is the offset of the magic in the header of a tar archive.
+const tarMagicOffset = 257
+
+// unpack reads documents from a file with a given name and calls fn for every one of them. Compressed files
+// (gzip, zstd) are decompressed and members of archives (tar) are read one by one, so each of them can be parsed
+// as a separate file, before the format of records is detected. Other compressions are not supported, such files
+// are passed to fn as they are. A decompressed file is named without the compression suffix
+// and a member of an archive is named <archive>/<member>. An error of fn does not stop reading of other members,
+// unpack returns the first error of reading or of fn.
+func unpack(reader io.Reader, name string, fn func(reader *bufio.Reader, name string) error) error {
+	buffered := bufio.NewReaderSize(reader, headSize)
+
+	head, err := buffered.Peek(headSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+
+		return unpack(decompressed, decompressedName(name), fn)
+	case bytes.HasPrefix(head, zstdMagic):
+		decompressed, err := zstd.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer decompressed.Close()
+
+		return unpack(decompressed, decompressedName(name), fn)
+	case len(head) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return unpackTar(tar.NewReader(buffered), name, fn)
+	default:
+		return fn(buffered, name)
+	}
+}
+
+// unpackTar calls unpack for every regular file of a tar archive.
+func unpackTar(archive *tar.Reader, name string, fn func(reader *bufio.Reader, name string) error) error {
+	var first error
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return first
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err = unpack(archive, name+"/"+strings.TrimPrefix(header.Name, "./"), fn); err != nil && first == nil {
+			first = err
+		}
+	}
+}
+
+// decompressedName returns name of a gzip or zstd compressed file without the compression suffix.
+func decompressedName(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".tgz"):
+		return strings.TrimSuffix(name, ".tgz") + ".tar"
+	case strings.HasSuffix(name, ".tzst"):
+		return strings.TrimSuffix(name, ".tzst") + ".tar"
+	case strings.HasSuffix(name, ".gz"):
+		return strings.TrimSuffix(name, ".gz")
+	case strings.HasSuffix(name, ".zst"):
+		return strings.TrimSuffix(name, ".zst")
+	default:
+		return name
+	}
+}
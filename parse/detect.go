@@ -0,0 +1,229 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/goat-project/exporter/record"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/sirupsen/logrus"
+)
+
+// Formats of record files.
+const (
+	FormatVM      = record.KindVM
+	FormatIP      = record.KindIP
+	FormatStorage = record.KindStorage
+	FormatStAR    = "star"
+	FormatUnknown = "unknown"
+)
+
+// headSize is the number of bytes from the beginning of a file used for detection.
+const headSize = 3072
+
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Detector detects format of a record file from its name and the beginning of its content.
+type Detector interface {
+	// Name returns name of the detector.
+	Name() string
+	// Detect returns format of the file and true if the format is recognized; false otherwise.
+	Detect(name string, head []byte) (string, bool)
+}
+
+// Detectors returns the default chain of detectors. A file is detected by name patterns first,
+// then by content using detectors of registered formats (APEL header, JSON with Ips key,
+// XML with STORAGES root, StAR XML, ...), and by mime type at the end.
+func Detectors(patterns []Pattern) []Detector {
+	detectors := []Detector{NameDetector{Patterns: patterns}}
+	for _, f := range Formats() {
+		if f.Detector != nil {
+			detectors = append(detectors, f.Detector)
+		}
+	}
+
+	return append(detectors, MimeDetector{})
+}
+
+// Detect detects format of a file using detectors in a given order.
+// It returns the format and the name of the detector which recognized it.
+func Detect(detectors []Detector, name string, head []byte) (string, string) {
+	for _, d := range detectors {
+		if format, ok := d.Detect(name, head); ok {
+			return format, d.Name()
+		}
+	}
+
+	return FormatUnknown, ""
+}
+
+// Pattern maps file names matching a glob pattern to a format.
+type Pattern struct {
+	Pattern string `mapstructure:"pattern"`
+	Format  string `mapstructure:"format"`
+}
+
+// NameDetector detects format by file name patterns. The pattern is matched against the base name of the file.
+type NameDetector struct {
+	Patterns []Pattern
+}
+
+// Name returns name of the detector.
+func (d NameDetector) Name() string {
+	return "name"
+}
+
+// Detect detects format by the first matching pattern.
+func (d NameDetector) Detect(name string, head []byte) (string, bool) {
+	for _, p := range d.Patterns {
+		matched, err := filepath.Match(p.Pattern, filepath.Base(name))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "pattern": p.Pattern}).Error("error match pattern")
+			continue
+		}
+
+		if matched {
+			return p.Format, true
+		}
+	}
+
+	return "", false
+}
+
+// APELDetector detects vm/server records by APEL message in the first line.
+type APELDetector struct{}
+
+// Name returns name of the detector.
+func (d APELDetector) Name() string {
+	return "apel"
+}
+
+// Detect detects APEL message header.
+func (d APELDetector) Detect(name string, head []byte) (string, bool) {
+	return FormatVM, bytes.HasPrefix(bytes.TrimPrefix(head, bom), []byte(apelHeader))
+}
+
+// IPDetector detects IP records by JSON object with Ips key.
+type IPDetector struct{}
+
+// Name returns name of the detector.
+func (d IPDetector) Name() string {
+	return "json-ips"
+}
+
+// Detect detects JSON object with Ips key in any case on the top level.
+func (d IPDetector) Detect(name string, head []byte) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(head, bom)))
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return "", false
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+
+		if field, ok := key.(string); ok && strings.EqualFold(field, "Ips") { // as accepted by the parser
+			return FormatIP, true
+		}
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return "", false // value exceeds the head
+		}
+	}
+
+	return "", false
+}
+
+// StorageDetector detects storage records by XML with STORAGES root element.
+type StorageDetector struct{}
+
+// Name returns name of the detector.
+func (d StorageDetector) Name() string {
+	return "xml-storages"
+}
+
+// Detect detects XML root element STORAGES.
+func (d StorageDetector) Detect(name string, head []byte) (string, bool) {
+	return FormatStorage, xmlRoot(head).Local == "STORAGES"
+}
+
+// StARDetector detects storage records in EMI StAR format by XML root element
+// sr:StorageUsageRecords or sr:StorageUsageRecord in StAR namespace.
+type StARDetector struct{}
+
+// Name returns name of the detector.
+func (d StARDetector) Name() string {
+	return "xml-star"
+}
+
+// Detect detects XML root element in StAR namespace.
+func (d StARDetector) Detect(name string, head []byte) (string, bool) {
+	return FormatStAR, starRoot(xmlRoot(head))
+}
+
+// MimeDetector detects format by mime types of registered formats.
+type MimeDetector struct{}
+
+// Name returns name of the detector.
+func (d MimeDetector) Name() string {
+	return "mime"
+}
+
+// Detect detects format by mime type of the content.
+func (d MimeDetector) Detect(name string, head []byte) (string, bool) {
+	mime := mimetype.Detect(head).String()
+	for _, f := range Formats() {
+		for _, m := range f.Mimes {
+			if m == mime {
+				return f.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// xmlRoot returns name of the root element or empty name when the content is not XML.
+func xmlRoot(head []byte) xml.Name {
+	dec := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(head, bom)))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil // only the root element is needed
+	}
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return xml.Name{}
+		}
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			return e.Name
+		case xml.CharData:
+			if len(bytes.TrimSpace(e)) > 0 {
+				return xml.Name{}
+			}
+		}
+	}
+}
+
+// skipBOM skips UTF-8 byte order mark at the beginning of a reader.
+func skipBOM(reader *bufio.Reader) error {
+	b, err := reader.Peek(len(bom))
+	if err == nil && bytes.Equal(b, bom) {
+		_, err = reader.Discard(len(bom))
+		return err
+	}
+
+	return nil
+}
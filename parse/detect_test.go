@@ -0,0 +1,185 @@
+package parse
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//  Tests:
+//  name pattern                    x
+//  APEL header                     x
+//  APEL with non-UTF-8 bytes       x
+//  JSON with Ips key               x
+//  JSON with lowercase ips key     x
+//  JSON with BOM                   x
+//  JSON without Ips key            x
+//  XML with STORAGES root          x
+//  XML without prolog              x
+//  StAR XML                        x
+//  XML in other namespace          x
+//  mime type fallback              x
+//  unknown                         x
+
+var _ = Describe("Format detection tests", func() {
+	var (
+		detectors []Detector
+		name      string
+		head      []byte
+		format    string
+		detector  string
+	)
+
+	BeforeEach(func() {
+		detectors = Detectors([]Pattern{{Pattern: "*.apel", Format: FormatVM}})
+		name = "records"
+	})
+
+	JustBeforeEach(func() {
+		format, detector = Detect(detectors, name, head)
+	})
+
+	Context("when file name matches pattern", func() {
+		BeforeEach(func() {
+			name = "/var/goat/out/records.apel"
+			head = []byte("anything")
+		})
+
+		It("should be detected by name", func() {
+			Expect(format).To(Equal(FormatVM))
+			Expect(detector).To(Equal("name"))
+		})
+	})
+
+	Context("when file has APEL header", func() {
+		BeforeEach(func() {
+			head = []byte("APEL-cloud-message: v0.4\nVMUUID: 1\n")
+		})
+
+		It("should be detected as vm", func() {
+			Expect(format).To(Equal(FormatVM))
+			Expect(detector).To(Equal("apel"))
+		})
+	})
+
+	Context("when APEL file contains non-UTF-8 bytes", func() {
+		BeforeEach(func() {
+			head = []byte("APEL-cloud-message: v0.4\nMachineName: \xe9\xff\n")
+		})
+
+		It("should be detected as vm", func() {
+			Expect(format).To(Equal(FormatVM))
+			Expect(detector).To(Equal("apel"))
+		})
+	})
+
+	Context("when file is JSON with Ips key", func() {
+		BeforeEach(func() {
+			head = []byte(`{"Version": {"major": 1}, "Ips": [{"SiteName": "site"`)
+		})
+
+		It("should be detected as ip", func() {
+			Expect(format).To(Equal(FormatIP))
+			Expect(detector).To(Equal("json-ips"))
+		})
+	})
+
+	Context("when JSON file has lowercase ips key", func() {
+		BeforeEach(func() {
+			head = []byte(`{"ips": [{"SiteName": "site"`)
+		})
+
+		It("should be detected as ip", func() {
+			Expect(format).To(Equal(FormatIP))
+			Expect(detector).To(Equal("json-ips"))
+		})
+	})
+
+	Context("when JSON file starts with BOM", func() {
+		BeforeEach(func() {
+			head = []byte("\xef\xbb\xbf{\"Ips\": []}")
+		})
+
+		It("should be detected as ip", func() {
+			Expect(format).To(Equal(FormatIP))
+			Expect(detector).To(Equal("json-ips"))
+		})
+	})
+
+	Context("when file is JSON without Ips key", func() {
+		BeforeEach(func() {
+			head = []byte(`{"Storages": []}`)
+		})
+
+		It("should be detected by mime type", func() {
+			Expect(format).To(Equal(FormatIP))
+			Expect(detector).To(Equal("mime"))
+		})
+	})
+
+	Context("when file is XML with STORAGES root", func() {
+		BeforeEach(func() {
+			head = []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<STORAGES>\n <STORAGE>")
+		})
+
+		It("should be detected as st", func() {
+			Expect(format).To(Equal(FormatStorage))
+			Expect(detector).To(Equal("xml-storages"))
+		})
+	})
+
+	Context("when XML file has no prolog", func() {
+		BeforeEach(func() {
+			head = []byte("\n<STORAGES><STORAGE><RECORD_ID>1</RECORD_ID>")
+		})
+
+		It("should be detected as st", func() {
+			Expect(format).To(Equal(FormatStorage))
+			Expect(detector).To(Equal("xml-storages"))
+		})
+	})
+
+	Context("when file is StAR XML", func() {
+		BeforeEach(func() {
+			head = []byte("<?xml version=\"1.0\"?>\n<sr:StorageUsageRecords " +
+				"xmlns:sr=\"http://eu-emi.eu/namespaces/2011/02/storagerecord\">\n <sr:StorageUsageRecord>")
+		})
+
+		It("should be detected as star", func() {
+			Expect(format).To(Equal(FormatStAR))
+			Expect(detector).To(Equal("xml-star"))
+		})
+	})
+
+	Context("when XML root is in other namespace", func() {
+		BeforeEach(func() {
+			head = []byte("<?xml version=\"1.0\"?>\n<StorageUsageRecords xmlns=\"http://example.org/\">")
+		})
+
+		It("should be detected by mime type", func() {
+			Expect(format).To(Equal(FormatStorage))
+			Expect(detector).To(Equal("mime"))
+		})
+	})
+
+	Context("when file is plain text", func() {
+		BeforeEach(func() {
+			head = []byte("VMUUID: 1\n")
+		})
+
+		It("should be detected by mime type", func() {
+			Expect(format).To(Equal(FormatVM))
+			Expect(detector).To(Equal("mime"))
+		})
+	})
+
+	Context("when file is unknown", func() {
+		BeforeEach(func() {
+			head = []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}
+		})
+
+		It("should not be detected", func() {
+			Expect(format).To(Equal(FormatUnknown))
+			Expect(detector).To(BeEmpty())
+		})
+	})
+})
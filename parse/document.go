@@ -0,0 +1,109 @@
+package parse
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/sirupsen/logrus"
+)
+
+// errUnknownType is returned when the format of a document is not detected.
+var errUnknownType = errors.New("unknown file type")
+
+// Options are options of parsing of record documents shared by watched files and pushed documents. Format
+// of documents is detected by Detectors in a given order, records are emitted
+// in batches of at most BatchSize records and validated according to Validation. Processing of documents
+// is counted by Metrics.
+type Options struct {
+	Detectors  []Detector
+	BatchSize  int
+	Validation Validation
+	Metrics    *metrics.Metrics
+}
+
+// ParseDocument detects format of a record document which does not come from a watched file (e.g. a document
+// pushed to the push endpoint) and parses it by the parser of the format. Name is used for detection by name
+// patterns and as the source of records. The document is parsed, logged and counted like a file, records
+// of a document rejected as a whole are not emitted. It returns the detected format and the report
+// of validation, the report is nil when the format was not detected.
+func ParseDocument(reader io.Reader, name string, options Options, emit func(record.Record)) (string, *Report,
+	error) {
+	return parseDocument(bufio.NewReaderSize(reader, headSize), name, name, options, emit)
+}
+
+// parseDocument detects format of a document with a given name (a file, a member of an archive file or a received
+// document), parses it and emits its records with a given source. Records of a document which may be rejected
+// as a whole are emitted after the whole document is validated. It returns the format, the report of validation
+// (nil when the format was not detected) and an error when the document was not parsed.
+func parseDocument(reader *bufio.Reader, source, name string, options Options, emit func(record.Record)) (string,
+	*Report, error) {
+	m := options.Metrics
+
+	head, err := reader.Peek(headSize)
+	if err != nil && err != io.EOF {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error detect file type")
+		failed(m, FormatUnknown, metrics.ReasonDetect)
+		return FormatUnknown, nil, err
+	}
+
+	format, detector := Detect(options.Detectors, name, head)
+	m.FilesSeen.WithLabelValues(format, detector).Inc()
+
+	f, ok := lookup(format)
+	if !ok {
+		logrus.WithFields(logrus.Fields{"type": mimetype.Detect(head).String(), "file": name}).Error(
+			"unknown file type")
+		m.FilesFailed.WithLabelValues(format, metrics.ReasonUnknown).Inc()
+		return format, nil, errUnknownType
+	}
+
+	records := 0
+	emitted := func(rec record.Record) {
+		records += rec.Len()
+		emit(rec)
+	}
+
+	var pending []record.Record
+	send := emitted
+	report := options.Validation.Report()
+	if report.RejectsFile() {
+		send = func(rec record.Record) {
+			pending = append(pending, rec)
+		}
+	}
+
+	start := time.Now()
+	err = f.Parse(reader, source, options.BatchSize, report, send)
+	m.ParseDuration.WithLabelValues(format).Observe(time.Since(start).Seconds())
+
+	problems(m, name, format, report)
+
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name, "type": format,
+			"detector": detector}).Error("error parse file")
+		m.FilesFailed.WithLabelValues(format, metrics.ReasonParse).Inc()
+		return format, report, err
+	}
+
+	if err = report.err(); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name, "type": format}).Error("file rejected")
+		m.FilesFailed.WithLabelValues(format, metrics.ReasonInvalid).Inc()
+		return format, report, err
+	}
+
+	for _, rec := range pending {
+		emitted(rec)
+	}
+
+	logrus.WithFields(logrus.Fields{"type": format, "file": name, "detector": detector,
+		"records": records}).Debug("file parsed")
+	m.FilesParsed.WithLabelValues(format).Inc()
+
+	return format, report, nil
+}
@@ -1,92 +1,246 @@
 package parse
 
 import (
+	"bufio"
 	"os"
 
+	"github.com/goat-project/exporter/ledger"
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/quarantine"
 	"github.com/goat-project/exporter/record"
+	"github.com/goat-project/exporter/watch"
 
 	"github.com/fsnotify/fsnotify"
-	"github.com/gabriel-vasile/mimetype"
 	"github.com/sirupsen/logrus"
 )
 
 // Parser structure with event channel for incoming events and record channel for parsed records.
+// When Ledger is set, files already processed with the same content are skipped.
+// When Quarantine is set, files of unknown type or files which cannot be parsed are put to quarantine.
+// Format of files is detected by Detectors in a given order.
+// Records are put to record channel in batches of at most BatchSize records.
+// Records are validated according to Validation, files rejected by validation are put to quarantine too.
+// When Roots are set, only files matching patterns of their root are parsed, as the format of their root if it is set.
+// Compressed files are decompressed and members of archives are parsed as separate files before detection.
+// Processing of files is counted by Metrics.
 type Parser struct {
 	EventChan  chan fsnotify.Event
 	RecordChan chan record.Record
+	Ledger     *ledger.Ledger
+	Quarantine *quarantine.Quarantine
+	Detectors  []Detector
+	BatchSize  int
+	Validation Validation
+	Roots      watch.Roots
+	Metrics    *metrics.Metrics
 }
 
+// DefaultBatchSize is the default maximal number of records put to record channel at once.
+const DefaultBatchSize = 1000
+
 const (
 	mimePlaintext = "text/plain; charset=utf-8"
 	mimeJSON      = "application/json"
 	mimeXML       = "text/xml; charset=utf-8"
 )
 
-// SetParser sets event and record channels to parser.
+// SetParser sets event and record channels, the default detectors, lenient validation and new metrics to parser.
 func SetParser(eventChan chan fsnotify.Event, recordChan chan record.Record) *Parser {
 	return &Parser{
 		EventChan:  eventChan,
 		RecordChan: recordChan,
+		Detectors:  Detectors(nil),
+		BatchSize:  DefaultBatchSize,
+		Validation: Validation{Mode: ModeLenient, Reject: RejectFile},
+		Metrics:    metrics.New(),
 	}
 }
 
 // Parse takes event from channel, parses content and put to record channel to export to Prometheus.
+// Records of a file which fails to parse may be partially put to record channel.
+// When a file is removed or renamed, its records are retired.
 func (p Parser) Parse() {
 	for event := range p.EventChan {
-		file, err := os.Open(event.Name)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{"error": err, "file": event.Name}).Error("error open file")
+		if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+			p.retire(event.Name)
 			continue
 		}
 
-		mimeType, err := mimetype.DetectFile(file.Name())
-		if err != nil {
-			logrus.WithFields(logrus.Fields{"error": err, "file": event.Name}).Error("error detect mime type")
+		p.parseFile(event.Name, false)
+	}
+}
+
+// Restore parses all files referenced by ledger again and puts them to record channel,
+// so the exported state is rebuilt after restart. Files which no longer exist are removed from ledger.
+func (p Parser) Restore() {
+	if p.Ledger == nil {
+		return
+	}
+
+	for _, entry := range p.Ledger.Entries() {
+		if _, err := os.Stat(entry.Path); os.IsNotExist(err) {
+			logrus.WithField("file", entry.Path).Debug("file from ledger does not exist")
+			p.removeFromLedger(entry.Path)
 			continue
 		}
 
-		switch mimeType.String() {
-		case mimePlaintext:
-			vms, err := VMRecords(file)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{"error": err, "file": file.Name(),
-					"type": "vm"}).Error("error parse file")
-				closeFile(file)
-				continue
-			}
-
-			p.RecordChan <- vms
-		case mimeJSON:
-			ips, err := IPRecords(file)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{"error": err, "file": file.Name(),
-					"type": "ip"}).Error("error parse file")
-				closeFile(file)
-				continue
-			}
-
-			p.RecordChan <- ips
-		case mimeXML:
-			storages, err := StorageRecords(file)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{"error": err, "file": file.Name(),
-					"type": "st"}).Error("error parse file")
-				closeFile(file)
-				continue
-			}
-
-			p.RecordChan <- storages
-		default:
-			logrus.WithFields(logrus.Fields{"type": mimeType.String(), "file": file.Name()}).Error("unknown file type")
-			closeFile(file)
-			continue
+		p.parseFile(entry.Path, true)
+	}
+}
+
+// parseFile opens, parses and puts file content to record channel. Files already processed
+// according to ledger are skipped unless force is set.
+func (p Parser) parseFile(name string, force bool) {
+	if !p.Roots.Match(name) {
+		logrus.WithField("file", name).Debug("file excluded")
+		return
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error open file")
+		failed(p.Metrics, FormatUnknown, metrics.ReasonOpen)
+		return
+	}
+
+	defer closeFile(file)
+
+	var entry ledger.Entry
+	if p.Ledger != nil {
+		entry, err = ledger.NewEntry(file)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error read file")
+			failed(p.Metrics, FormatUnknown, metrics.ReasonRead)
+			return
+		}
+
+		if !force && p.Ledger.Processed(entry) {
+			logrus.WithField("file", name).Debug("file already processed")
+			return
+		}
+	}
+
+	records := 0
+	format := FormatUnknown
+	var failure error
+	err = unpack(file, name, func(reader *bufio.Reader, member string) error {
+		n, f, err := p.parseMember(reader, name, member)
+		records += n
+		if err != nil && failure == nil {
+			format, failure = f, err
 		}
 
-		logrus.WithFields(logrus.Fields{"type": mimeType.String(), "file": file.Name()}).Debug("file parsed")
-		closeFile(file)
+		return nil
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error unpack file")
+		failed(p.Metrics, FormatUnknown, metrics.ReasonRead)
+		p.quarantine(name, FormatUnknown, err)
+		return
+	}
+
+	if failure != nil {
+		p.quarantine(name, format, failure)
+		return
+	}
+
+	if p.Ledger != nil {
+		entry.Records = records
+		if err = p.Ledger.Add(entry); err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error add file to ledger")
+		}
 	}
 }
 
+// parseMember parses a file or a member of an archive file like any other document and puts its records
+// to record channel. Records come from the source file, so they are retired with it. It returns the number
+// of records put to record channel, the format and an error when the member was not parsed.
+func (p Parser) parseMember(reader *bufio.Reader, source, name string) (int, string, error) {
+	records := 0
+	format, _, err := parseDocument(reader, source, name, p.options(source), func(rec record.Record) {
+		records += rec.Len()
+		p.RecordChan <- rec
+	})
+
+	return records, format, err
+}
+
+// options returns options of parsing of files from a given source.
+func (p Parser) options(source string) Options {
+	return Options{
+		Detectors:  p.detectors(source),
+		BatchSize:  p.BatchSize,
+		Validation: p.Validation,
+		Metrics:    p.Metrics,
+	}
+}
+
+// detectors returns detectors of files from a given source, the format of a root with a format is not detected.
+func (p Parser) detectors(source string) []Detector {
+	if root, ok := p.Roots.Find(source); ok && root.Format != "" {
+		return []Detector{NameDetector{Patterns: []Pattern{{Pattern: "*", Format: root.Format}}}}
+	}
+
+	return p.Detectors
+}
+
+// problems logs and counts problems of records of a file found by validation.
+func problems(m *metrics.Metrics, name, format string, report *Report) {
+	for _, problem := range report.Problems {
+		logrus.WithFields(logrus.Fields{"file": name, "type": format, "record": problem.Record, "line": problem.Line,
+			"field": problem.Field, "reason": problem.Reason, "detail": problem.Detail}).Warn("invalid record")
+		m.RecordProblems.WithLabelValues(format, problem.Reason).Inc()
+	}
+
+	if report.Rejected > 0 && !report.RejectsFile() {
+		logrus.WithFields(logrus.Fields{"file": name, "type": format, "records": report.Rejected}).Warn(
+			"records rejected")
+		m.RecordsRejected.WithLabelValues(format).Add(float64(report.Rejected))
+	}
+}
+
+// quarantine puts a file which failed to quarantine if it is set.
+func (p Parser) quarantine(name, format string, cause error) {
+	if p.Quarantine == nil {
+		return
+	}
+
+	entry, err := p.Quarantine.Put(name, format, cause)
+	if err == quarantine.ErrQuarantined {
+		logrus.WithFields(logrus.Fields{"file": name, "quarantined": entry.Name}).Debug("file already quarantined")
+		return
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error quarantine file")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"file": name, "quarantined": entry.Name}).Info("file quarantined")
+}
+
+// retire puts retired records of a given file to record channel and removes the file from ledger.
+func (p Parser) retire(name string) {
+	if p.Ledger != nil {
+		p.removeFromLedger(name)
+	}
+
+	p.RecordChan <- record.Retired{Source: name}
+
+	logrus.WithField("file", name).Debug("file retired")
+}
+
+func (p Parser) removeFromLedger(name string) {
+	if err := p.Ledger.Remove(name); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "file": name}).Error("error remove file from ledger")
+	}
+}
+
+// failed counts a file which failed before its format was known.
+func failed(m *metrics.Metrics, format, reason string) {
+	m.FilesSeen.WithLabelValues(format, "").Inc()
+	m.FilesFailed.WithLabelValues(format, reason).Inc()
+}
+
 func closeFile(file *os.File) {
 	err := file.Close()
 	if err != nil {
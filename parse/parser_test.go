@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -8,8 +9,13 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/fsnotify/fsnotify"
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/quarantine"
 	"github.com/goat-project/exporter/record"
+	"github.com/goat-project/exporter/watch"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,6 +35,10 @@ func TestResources(t *testing.T) {
 //  - another mime type         x
 //  - undetectable mime type    x
 //  - close closed file         x
+//  - removed file              x
+//  - quarantined file          x
+//  - rejected file             x
+//  - file of watched root      x
 
 var _ = Describe("Record parser tests", func() {
 	dirPath := "test-data/"
@@ -72,6 +82,7 @@ var _ = Describe("Record parser tests", func() {
 				storages := rec.(record.Storages)
 
 				Expect(len(storages.Storages)).To(Equal(10))
+				Expect(storages.Source).To(Equal(filepath.Join(dirPath, filepath.Clean("st/0000_correctXML_10"))))
 				close(done)
 			}, 0.2)
 		})
@@ -110,6 +121,23 @@ var _ = Describe("Record parser tests", func() {
 			}, 0.2)
 		})
 
+		Context("when file is removed", func() {
+			It("should retire its records", func(done Done) {
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("st/0000_correctXML_10"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+					Op:   fsnotify.Remove,
+				}
+
+				rec := <-parser.RecordChan
+
+				Expect(rec).To(Equal(record.Retired{Source: name}))
+				close(done)
+			}, 0.2)
+		})
+
 		Context("when file is not correct XML", func() {
 			It("should return an error", func(done Done) {
 				go parser.Parse()
@@ -200,6 +228,78 @@ var _ = Describe("Record parser tests", func() {
 			}, 0.2)
 		})
 
+		Context("when file has another mime type and quarantine is set", func() {
+			quarantinePath := "/tmp/goat/parser-quarantine-test"
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(quarantinePath)).NotTo(HaveOccurred())
+			})
+
+			It("should put the file to quarantine", func(done Done) {
+				q := quarantine.Quarantine{Path: quarantinePath}
+				parser.Quarantine = &q
+
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("text.csv"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				for len(hook.Entries) < 2 { // wait while hooks are written
+				}
+
+				Expect(hook.LastEntry().Message).To(Equal("file quarantined"))
+
+				entries, err := q.List()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Source).To(Equal(name))
+				Expect(entries[0].Error).To(Equal("unknown file type"))
+
+				_, err = os.Stat(filepath.Join(quarantinePath, entries[0].Name))
+				Expect(err).NotTo(HaveOccurred())
+
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when records are invalid in strict mode and quarantine is set", func() {
+			quarantinePath := "/tmp/goat/parser-rejected-test"
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(quarantinePath)).NotTo(HaveOccurred())
+			})
+
+			It("should reject the whole file", func(done Done) {
+				q := quarantine.Quarantine{Path: quarantinePath}
+				parser.Quarantine = &q
+				parser.Validation = Validation{Mode: ModeStrict, Reject: RejectFile}
+
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("vm/0017_invalid_values"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				for len(hook.Entries) < 4 { // wait while hooks are written
+				}
+
+				Expect(hook.Entries[0].Message).To(Equal("invalid record"))
+				Expect(hook.Entries[2].Message).To(Equal("file rejected"))
+				Expect(hook.LastEntry().Message).To(Equal("file quarantined"))
+				Expect(parser.RecordChan).To(BeEmpty())
+
+				entries, err := q.List()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Source).To(Equal(name))
+
+				close(done)
+			}, 0.2)
+		})
+
 		Context("when file has undetectable mime type", func() {
 			It("should return an error", func(done Done) {
 				go parser.Parse()
@@ -215,6 +315,280 @@ var _ = Describe("Record parser tests", func() {
 		})
 	})
 
+	Describe("instrumenting parser", func() {
+		Context("when file is parsed", func() {
+			It("should count it as seen and parsed", func(done Done) {
+				go parser.Parse()
+
+				parser.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "ip/0000_correctJSON_20")}
+				<-parser.RecordChan
+				parser.EventChan <- fsnotify.Event{Name: "asdf"} // the first file was finished
+
+				m := parser.Metrics
+				Expect(testutil.ToFloat64(m.FilesSeen.WithLabelValues(FormatIP, IPDetector{}.Name()))).To(Equal(1.0))
+				Expect(testutil.ToFloat64(m.FilesParsed.WithLabelValues(FormatIP))).To(Equal(1.0))
+
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when file fails", func() {
+			It("should count it as failed by reason", func(done Done) {
+				go parser.Parse()
+
+				parser.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "text.csv")}
+				parser.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "ip/0009_wrong_format")}
+				parser.EventChan <- fsnotify.Event{Name: "asdf"} // the previous files were finished
+
+				m := parser.Metrics
+				Expect(testutil.ToFloat64(m.FilesFailed.WithLabelValues(FormatUnknown, metrics.ReasonUnknown))).To(
+					Equal(1.0))
+				Expect(testutil.ToFloat64(m.FilesFailed.WithLabelValues(FormatIP, metrics.ReasonParse))).To(Equal(1.0))
+
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when parsers have their own metrics", func() {
+			It("should not count files of other parsers", func(done Done) {
+				other := SetParser(make(chan fsnotify.Event), make(chan record.Record, 1))
+
+				go other.Parse()
+
+				other.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "ip/0000_correctJSON_20")}
+				<-other.RecordChan
+				close(other.EventChan)
+
+				Expect(testutil.ToFloat64(other.Metrics.FilesParsed.WithLabelValues(FormatIP))).To(Equal(1.0))
+				Expect(testutil.ToFloat64(parser.Metrics.FilesParsed.WithLabelValues(FormatIP))).To(BeZero())
+
+				close(done)
+			}, 0.2)
+		})
+	})
+
+	Describe("parsing document", func() {
+		var options Options
+
+		BeforeEach(func() {
+			options = Options{Detectors: Detectors(nil), BatchSize: DefaultBatchSize,
+				Validation: Validation{Mode: ModeStrict, Reject: RejectFile}, Metrics: metrics.New()}
+		})
+
+		Context("when document is correct", func() {
+			It("should emit its records from the document like from a file", func() {
+				file, err := os.Open(filepath.Join(dirPath, "ip/0000_correctJSON_20"))
+				Expect(err).NotTo(HaveOccurred())
+				defer closeFile(file)
+
+				var records []record.Record
+				format, report, err := ParseDocument(file, "goat://server/ips", options, func(rec record.Record) {
+					records = append(records, rec)
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(format).To(Equal(FormatIP))
+				Expect(report).NotTo(BeNil())
+				Expect(records).To(HaveLen(1))
+				Expect(records[0].(record.IPs).Source).To(Equal("goat://server/ips"))
+
+				Expect(testutil.ToFloat64(options.Metrics.FilesParsed.WithLabelValues(FormatIP))).To(Equal(1.0))
+			})
+		})
+
+		Context("when document is rejected as a whole", func() {
+			It("should emit no records and fail like a file", func() {
+				file, err := os.Open(filepath.Join(dirPath, "vm/0017_invalid_values"))
+				Expect(err).NotTo(HaveOccurred())
+				defer closeFile(file)
+
+				emitted := 0
+				_, _, err = ParseDocument(file, "goat://server/vms", options, func(rec record.Record) {
+					emitted++
+				})
+				Expect(err).To(HaveOccurred())
+				Expect(emitted).To(BeZero())
+
+				Expect(hook.LastEntry().Message).To(Equal("file rejected"))
+				Expect(testutil.ToFloat64(options.Metrics.FilesFailed.WithLabelValues(FormatVM,
+					metrics.ReasonInvalid))).To(Equal(1.0))
+			})
+		})
+
+		Context("when document type is unknown", func() {
+			It("should return no report", func() {
+				file, err := os.Open(filepath.Join(dirPath, "text.csv"))
+				Expect(err).NotTo(HaveOccurred())
+				defer closeFile(file)
+
+				_, report, err := ParseDocument(file, "goat://server/text", options, func(record.Record) {})
+				Expect(err).To(MatchError("unknown file type"))
+				Expect(report).To(BeNil())
+			})
+		})
+	})
+
+	Describe("parsing file of watched roots", func() {
+		JustBeforeEach(func() {
+			parser.Roots = watch.Roots{
+				{Path: filepath.Join(dirPath, "vm"), Exclude: []string{"0000_*"}},
+				{Path: filepath.Join(dirPath, "st"), Format: FormatStorage},
+			}
+		})
+
+		Context("when file is excluded", func() {
+			It("should parse only files matching patterns of their root", func(done Done) {
+				go parser.Parse()
+
+				parser.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "vm/0000_correctAPEL_10")}
+				parser.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "ip/0000_correctJSON_20")}
+				parser.EventChan <- fsnotify.Event{Name: filepath.Join(dirPath, "vm/0002_missing_VMUUID_string")}
+
+				vms := (<-parser.RecordChan).(record.VMs)
+				Expect(vms.Source).To(Equal(filepath.Join(dirPath, "vm/0002_missing_VMUUID_string")))
+
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when root has a format", func() {
+			It("should not detect format of its files", func() {
+				Expect(parser.detectors(filepath.Join(dirPath, "st/0000_correctXML_10"))).To(Equal([]Detector{
+					NameDetector{Patterns: []Pattern{{Pattern: "*", Format: FormatStorage}}}}))
+				Expect(parser.detectors(filepath.Join(dirPath, "vm/0000_correctAPEL_10"))).To(Equal(parser.Detectors))
+			})
+		})
+	})
+
+	Describe("parsing compressed and archived file", func() {
+		Context("when file is compressed by gzip", func() {
+			It("should parse the decompressed file", func(done Done) {
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("archive/0000_vms.apel.gz"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				rec := <-parser.RecordChan
+
+				vms := rec.(record.VMs)
+
+				Expect(vms.VMs).To(HaveLen(10))
+				Expect(vms.Source).To(Equal(name))
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when file is compressed tar archive", func() {
+			It("should parse every member as a separate file", func(done Done) {
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("archive/0001_records.tar.gz"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				ips := (<-parser.RecordChan).(record.IPs)
+				vms := (<-parser.RecordChan).(record.VMs)
+
+				Expect(ips.Ips).To(HaveLen(20))
+				Expect(ips.Source).To(Equal(name))
+				Expect(vms.VMs).To(HaveLen(10))
+				Expect(vms.Source).To(Equal(name))
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when tar archive has a member of unknown type and quarantine is set", func() {
+			quarantinePath := "/tmp/goat/parser-archive-test"
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(quarantinePath)).NotTo(HaveOccurred())
+			})
+
+			It("should parse other members and put the archive to quarantine", func(done Done) {
+				q := quarantine.Quarantine{Path: quarantinePath}
+				parser.Quarantine = &q
+
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("archive/0002_unknown_member.tar"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				vms := (<-parser.RecordChan).(record.VMs)
+				Expect(vms.VMs).To(HaveLen(10))
+
+				for len(hook.Entries) < 2 { // wait while hooks are written
+				}
+
+				Expect(hook.Entries[0].Message).To(Equal("unknown file type"))
+				Expect(hook.Entries[0].Data["file"]).To(Equal(name + "/text.csv"))
+				Expect(hook.LastEntry().Message).To(Equal("file quarantined"))
+
+				entries, err := q.List()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Source).To(Equal(name))
+
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when compressed file is corrupted", func() {
+			var name string
+
+			BeforeEach(func() {
+				file, err := ioutil.TempFile("", "corrupted-*.gz")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = file.Write([]byte{0x1f, 0x8b, 0x00})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(file.Close()).To(Succeed())
+				name = file.Name()
+			})
+
+			AfterEach(func() {
+				Expect(os.Remove(name)).To(Succeed())
+			})
+
+			It("should return an error", func(done Done) {
+				go parser.Parse()
+
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				for len(hook.Entries) == 0 { // wait while hook is written
+				}
+
+				Expect(hook.LastEntry().Level).To(Equal(logrus.ErrorLevel))
+				Expect(hook.LastEntry().Message).To(Equal("error unpack file"))
+
+				close(done)
+			}, 0.2)
+		})
+
+		Context("when file is compressed by zstd", func() {
+			It("should parse the decompressed file", func(done Done) {
+				go parser.Parse()
+
+				name := filepath.Join(dirPath, filepath.Clean("archive/0003_vms.apel.zst"))
+				parser.EventChan <- fsnotify.Event{
+					Name: name,
+				}
+
+				rec := <-parser.RecordChan
+
+				vms := rec.(record.VMs)
+
+				Expect(vms.VMs).To(HaveLen(10))
+				Expect(vms.Source).To(Equal(name))
+				close(done)
+			}, 0.2)
+		})
+	})
+
 	Describe("closing file", func() {
 		Context("when file is closed", func() {
 			It("should return an error", func() {
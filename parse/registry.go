@@ -0,0 +1,113 @@
+package parse
+
+import (
+	"io"
+	"sync"
+
+	"github.com/goat-project/exporter/record"
+)
+
+// Format represents a record format which can be detected and parsed.
+type Format struct {
+	// Name identifies the format, it is usually the kind of parsed records.
+	Name string
+	// Detector detects the format by content, it is optional.
+	Detector Detector
+	// Mimes are mime types of the format used when no detector recognizes a file.
+	Mimes []string
+	// Parse parses records from a reader and emits them in batches of at most batchSize records,
+	// source is the file the records come from. Problems of records are collected to report,
+	// records rejected by report are not emitted.
+	Parse func(reader io.Reader, source string, batchSize int, report *Report, emit func(record.Record)) error
+}
+
+var (
+	formatsMutex sync.RWMutex
+	formats      = []Format{
+		{
+			Name:     FormatVM,
+			Detector: APELDetector{},
+			Mimes:    []string{mimePlaintext},
+			Parse:    parseVMs,
+		},
+		{
+			Name:     FormatIP,
+			Detector: IPDetector{},
+			Mimes:    []string{mimeJSON},
+			Parse:    parseIPs,
+		},
+		{
+			Name:     FormatStorage,
+			Detector: StorageDetector{},
+			Mimes:    []string{mimeXML},
+			Parse:    parseStorages,
+		},
+		{
+			Name:     FormatStAR,
+			Detector: StARDetector{},
+			Parse:    parseStAR,
+		},
+	}
+)
+
+// Register registers a record format. Formats are detected in the order of registration
+// after the built-in formats. A format with the name of already registered format replaces it.
+func Register(f Format) {
+	formatsMutex.Lock()
+	defer formatsMutex.Unlock()
+
+	for i := range formats {
+		if formats[i].Name == f.Name {
+			formats[i] = f
+			return
+		}
+	}
+
+	formats = append(formats, f)
+}
+
+// Formats returns all registered formats in the order of registration.
+func Formats() []Format {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+
+	return append([]Format(nil), formats...)
+}
+
+func lookup(name string) (Format, bool) {
+	for _, f := range Formats() {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return Format{}, false
+}
+
+func parseVMs(reader io.Reader, source string, batchSize int, report *Report, emit func(record.Record)) error {
+	return StreamVMRecords(reader, batchSize, report, func(vms record.VMs) {
+		vms.Source = source
+		emit(vms)
+	})
+}
+
+func parseIPs(reader io.Reader, source string, batchSize int, report *Report, emit func(record.Record)) error {
+	return StreamIPRecords(reader, batchSize, report, func(ips record.IPs) {
+		ips.Source = source
+		emit(ips)
+	})
+}
+
+func parseStorages(reader io.Reader, source string, batchSize int, report *Report, emit func(record.Record)) error {
+	return StreamStorageRecords(reader, batchSize, report, func(storages record.Storages) {
+		storages.Source = source
+		emit(storages)
+	})
+}
+
+func parseStAR(reader io.Reader, source string, batchSize int, report *Report, emit func(record.Record)) error {
+	return StreamStARRecords(reader, batchSize, report, func(storages record.Storages) {
+		storages.Source = source
+		emit(storages)
+	})
+}
@@ -0,0 +1,98 @@
+package parse
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/goat-project/exporter/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testRecords struct {
+	lines  []string
+	source string
+}
+
+func (r testRecords) Kind() string {
+	return "test"
+}
+
+func (r testRecords) Len() int {
+	return len(r.lines)
+}
+
+type testDetector struct{}
+
+func (d testDetector) Name() string {
+	return "test-header"
+}
+
+func (d testDetector) Detect(name string, head []byte) (string, bool) {
+	return "test", bytes.HasPrefix(head, []byte("GOAT-TEST-RECORDS\n"))
+}
+
+var _ = Describe("Format registry tests", func() {
+	BeforeEach(func() {
+		Register(Format{
+			Name:     "test",
+			Detector: testDetector{},
+			Parse: func(reader io.Reader, source string, batchSize int, report *Report,
+				emit func(record.Record)) error {
+				data, err := ioutil.ReadAll(reader)
+				lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+				emit(testRecords{lines: lines[1:], source: source})
+
+				return err
+			},
+		})
+	})
+
+	Describe("registering format", func() {
+		Context("when format is registered", func() {
+			It("should be detected and parsed", func() {
+				content := "GOAT-TEST-RECORDS\na\nb\n"
+
+				format, detector := Detect(Detectors(nil), "records", []byte(content))
+				Expect(format).To(Equal("test"))
+				Expect(detector).To(Equal("test-header"))
+
+				f, ok := lookup(format)
+				Expect(ok).To(BeTrue())
+
+				var rec record.Record
+				err := f.Parse(strings.NewReader(content), "records", DefaultBatchSize, nil, func(r record.Record) {
+					rec = r
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rec.Kind()).To(Equal("test"))
+				Expect(rec.Len()).To(Equal(2))
+			})
+		})
+
+		Context("when format is registered again", func() {
+			It("should be replaced", func() {
+				count := len(Formats())
+
+				Register(Format{Name: "test", Detector: testDetector{}})
+
+				Expect(Formats()).To(HaveLen(count))
+			})
+		})
+
+		Context("when built-in formats are registered", func() {
+			It("should be detected first", func() {
+				names := []string{}
+				for _, f := range Formats()[:3] {
+					names = append(names, f.Name)
+				}
+
+				Expect(names).To(Equal([]string{FormatVM, FormatIP, FormatStorage}))
+			})
+		})
+	})
+})
@@ -0,0 +1,242 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goat-project/exporter/record"
+	"github.com/goat-project/exporter/utils"
+)
+
+// Validation modes.
+const (
+	// ModeLenient accepts records without validation.
+	ModeLenient = "lenient"
+	// ModeWarn validates records and reports their problems, records with problems are accepted.
+	ModeWarn = "warn"
+	// ModeStrict validates records and rejects records with problems.
+	ModeStrict = "strict"
+)
+
+// Scopes of rejection in strict mode.
+const (
+	// RejectFile rejects the whole file when any of its records has a problem.
+	RejectFile = "file"
+	// RejectRecord rejects only records with problems.
+	RejectRecord = "record"
+)
+
+// Reasons of record problems.
+const (
+	ReasonMalformed    = "malformed line"
+	ReasonUnknownField = "unknown field"
+	ReasonMissing      = "missing required field"
+	ReasonInvalid      = "invalid value"
+	ReasonUnterminated = "unterminated record"
+)
+
+// Validation configures validation of parsed records.
+type Validation struct {
+	Mode   string
+	Reject string
+}
+
+// Problem represents a problem of a parsed record. Record is the index of the record in a file
+// starting from 1, Line is the line number in the file or 0 when it is unknown.
+// Reason is one of the reasons above, Detail describes the problem more precisely.
+type Problem struct {
+	Record int
+	Line   int
+	Field  string
+	Reason string
+	Detail string
+}
+
+// String returns the problem in a readable form.
+func (p Problem) String() string {
+	s := fmt.Sprintf("record %d, line %d, field %q: %s", p.Record, p.Line, p.Field, p.Reason)
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+
+	return s
+}
+
+// Report collects problems of records of a single file. Records is the number of checked records.
+// Nil report accepts all records.
+type Report struct {
+	Validation
+	Problems []Problem
+	Records  int
+	Rejected int
+}
+
+// Validate checks mode and scope of rejection.
+func (v Validation) Validate() error {
+	switch v.Mode {
+	case ModeLenient, ModeWarn, ModeStrict:
+	default:
+		return fmt.Errorf("unknown validation mode: %s", v.Mode)
+	}
+
+	switch v.Reject {
+	case RejectFile, RejectRecord:
+	default:
+		return fmt.Errorf("unknown validation reject: %s", v.Reject)
+	}
+
+	return nil
+}
+
+// Report creates an empty report for a file.
+func (v Validation) Report() *Report {
+	return &Report{Validation: v}
+}
+
+// enabled returns true if records are validated.
+func (r *Report) enabled() bool {
+	return r != nil && (r.Mode == ModeWarn || r.Mode == ModeStrict)
+}
+
+// RejectsFile returns true if the whole file is rejected when any of its records has a problem.
+func (r *Report) RejectsFile() bool {
+	return r.enabled() && r.Mode == ModeStrict && r.Reject != RejectRecord
+}
+
+// check collects problems of a record with a given index and returns true if the record is accepted.
+func (r *Report) check(index int, problems []Problem) bool {
+	if r != nil && index > r.Records {
+		r.Records = index
+	}
+
+	if !r.enabled() || len(problems) == 0 {
+		return true
+	}
+
+	for i := range problems {
+		problems[i].Record = index
+	}
+	r.Problems = append(r.Problems, problems...)
+
+	if r.Mode != ModeStrict {
+		return true
+	}
+
+	r.Rejected++
+
+	return false
+}
+
+// err returns an error if the whole file is rejected.
+func (r *Report) err() error {
+	if !r.RejectsFile() || len(r.Problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d problems found in records, the first one: %s", len(r.Problems), r.Problems[0])
+}
+
+// requiredField is a required field of a record and its presence.
+type requiredField struct {
+	name    string
+	present bool
+}
+
+// validateVM returns problems of required fields of vm/server record starting at a given line.
+func validateVM(vm record.VM, line int) []Problem {
+	return required(line, []requiredField{
+		{"VMUUID", vm.VMUUID != ""},
+		{"SiteName", vm.SiteName != ""},
+		{"MachineName", vm.MachineName != ""},
+	})
+}
+
+// validateIP returns problems of required fields of IP record starting at a given line.
+func validateIP(ip record.IP, line int) []Problem {
+	problems := required(line, []requiredField{
+		{"MeasurementTime", ip.MeasurementTime != 0},
+		{"SiteName", ip.SiteName != ""},
+		{"CloudType", ip.CloudType != ""},
+		{"LocalUser", ip.LocalUser != ""},
+		{"LocalGroup", ip.LocalGroup != ""},
+		{"GlobalUserName", ip.GlobalUserName != ""},
+	})
+
+	if ip.IPVersion != 4 && ip.IPVersion != 6 {
+		problems = append(problems, Problem{Line: line, Field: "IPVersion", Reason: ReasonInvalid,
+			Detail: fmt.Sprintf("%d is not 4 or 6", ip.IPVersion)})
+	}
+
+	return problems
+}
+
+// validateStorage returns problems of required fields of storage record starting at a given line.
+func validateStorage(storage record.Storage, line int) []Problem {
+	return required(line, []requiredField{
+		{"RecordID", storage.RecordID != ""},
+		{"CreateTime", !storage.CreateTime.IsZero()},
+		{"StorageSystem", storage.StorageSystem != ""},
+		{"StartTime", !storage.StartTime.IsZero()},
+		{"EndTime", !storage.EndTime.IsZero()},
+	})
+}
+
+// fileCount parses the number of files of a storage record starting at a given line, an invalid number
+// is a problem of the record and it is not set.
+func fileCount(value *string, line int) (*uint64, []Problem) {
+	if value == nil {
+		return nil, nil
+	}
+
+	count, err := utils.ParseUint64(strings.TrimSpace(*value))
+	if err != nil {
+		return nil, []Problem{{Line: line, Field: "FileCount", Reason: ReasonInvalid, Detail: err.Error()}}
+	}
+
+	return count, nil
+}
+
+// required returns problems of required fields which are not present.
+func required(line int, fields []requiredField) []Problem {
+	var problems []Problem
+	for _, f := range fields {
+		if !f.present {
+			problems = append(problems, Problem{Line: line, Field: f.name, Reason: ReasonMissing})
+		}
+	}
+
+	return problems
+}
+
+// lineCounter counts lines of data read through it, so offsets of a decoder reading from it
+// can be converted to line numbers.
+type lineCounter struct {
+	reader   io.Reader
+	offset   int64
+	newlines []int64 // offsets of newlines after the last converted offset
+	line     int
+}
+
+// Read reads data and remembers offsets of newlines.
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\n' {
+			c.newlines = append(c.newlines, c.offset+int64(i))
+		}
+	}
+	c.offset += int64(n)
+
+	return n, err
+}
+
+// lineAt returns line number of a given offset. Offsets must be converted in increasing order.
+func (c *lineCounter) lineAt(offset int64) int {
+	for len(c.newlines) > 0 && c.newlines[0] < offset {
+		c.newlines = c.newlines[1:]
+		c.line++
+	}
+
+	return c.line + 1
+}
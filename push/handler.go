@@ -0,0 +1,180 @@
+package push
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/parse"
+	"github.com/goat-project/exporter/record"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Path is the path of the push endpoint.
+const Path = "/api/v1/records"
+
+// maxBodySize is the maximal size of a pushed document.
+const maxBodySize = 64 << 20
+
+// Handler receives record documents (APEL messages, IP JSON, storage XML, ...) in bodies of POST requests
+// and puts their records to record channel, so records can be pushed by sites which cannot share a directory
+// with the exporter. Documents are detected and parsed like files, the format can be forced by format query
+// parameter. Problems of records are reported even in lenient validation mode. When Token is set, requests
+// have to be authenticated by the bearer token. Processing of documents is counted by Metrics.
+type Handler struct {
+	RecordChan chan record.Record
+	Detectors  []parse.Detector
+	BatchSize  int
+	Validation parse.Validation
+	Token      string
+	Metrics    *metrics.Metrics
+}
+
+// Response is a result of a pushed document.
+type Response struct {
+	Format   string   `json:"format"`
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Records  []Result `json:"records"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Result is a result of one record of a pushed document, Record is the index of the record starting from 1.
+type Result struct {
+	Record   int       `json:"record"`
+	Accepted bool      `json:"accepted"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+// Problem is a problem of a pushed record.
+type Problem struct {
+	Line   int    `json:"line,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ServeHTTP parses a pushed document and responds with results of its records.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name := source(r)
+
+	detectors := h.Detectors
+	if format := r.URL.Query().Get("format"); format != "" {
+		detectors = []parse.Detector{parse.NameDetector{Patterns: []parse.Pattern{{Pattern: "*", Format: format}}}}
+	}
+
+	validation := h.Validation
+	if validation.Mode == parse.ModeLenient {
+		validation.Mode = parse.ModeWarn
+	}
+
+	options := parse.Options{Detectors: detectors, BatchSize: h.BatchSize, Validation: validation, Metrics: h.Metrics}
+	format, report, err := parse.ParseDocument(http.MaxBytesReader(w, r.Body, maxBodySize), name, options,
+		func(rec record.Record) {
+			h.RecordChan <- rec
+		})
+
+	response := results(format, report, err)
+	status := http.StatusOK
+	switch {
+	case report == nil:
+		status = http.StatusUnsupportedMediaType
+	case err != nil && report.RejectsFile() && len(report.Problems) > 0:
+		status = http.StatusUnprocessableEntity
+	case err != nil:
+		status = http.StatusBadRequest
+	}
+
+	if err != nil {
+		response.Error = err.Error() // the error is logged by parser
+	} else {
+		logrus.WithFields(logrus.Fields{"document": name, "type": format, "accepted": response.Accepted,
+			"rejected": response.Rejected}).Debug("pushed document parsed")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "document": name}).Error("error write push response")
+	}
+}
+
+// authorized checks bearer token of a request when the token is set.
+func (h Handler) authorized(r *http.Request) bool {
+	if h.Token == "" {
+		return true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.Token)) == 1
+}
+
+// results returns results of records of a parsed document. All records of a document rejected as a whole
+// are rejected, otherwise only records rejected by strict validation are rejected.
+func results(format string, report *parse.Report, err error) Response {
+	response := Response{Format: format, Records: []Result{}}
+	if report == nil {
+		return response
+	}
+
+	problems := make(map[int][]Problem)
+	for _, p := range report.Problems {
+		problems[p.Record] = append(problems[p.Record], Problem{Line: p.Line, Field: p.Field, Reason: p.Reason,
+			Detail: p.Detail})
+	}
+
+	// records of a document which may be rejected as a whole are put to record channel only when it is accepted
+	rejectedAll := err != nil && report.RejectsFile()
+
+	for i := 1; i <= report.Records; i++ {
+		result := Result{Record: i, Problems: problems[i]}
+		result.Accepted = !rejectedAll && (report.Mode != parse.ModeStrict || len(result.Problems) == 0)
+
+		if result.Accepted {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+		response.Records = append(response.Records, result)
+	}
+
+	return response
+}
+
+// source returns source of records of a pushed document, named by name query parameter or by the time
+// it was received.
+func source(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	return "push://" + host + "/" + name
+}
@@ -0,0 +1,175 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/parse"
+	"github.com/goat-project/exporter/record"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Push Suite")
+}
+
+var _ = Describe("Push handler tests", func() {
+	var (
+		handler    Handler
+		recordChan chan record.Record
+	)
+
+	apel, err := ioutil.ReadFile("../parse/test-data/vm/0000_correctAPEL_10")
+	if err != nil {
+		panic(err)
+	}
+
+	ips := []byte(`{"Ips": [
+ {"MeasurementTime": 1578480993, "SiteName": "site", "CloudType": "cloud", "LocalUser": "16", "LocalGroup": "7",
+  "GlobalUserName": "user", "IPVersion": 4, "IPCount": 5},
+ {"MeasurementTime": 1578480993, "SiteName": "site", "CloudType": "cloud", "LocalGroup": "7",
+  "GlobalUserName": "user", "IPVersion": 4, "IPCount": 5}
+]}`)
+
+	BeforeEach(func() {
+		recordChan = make(chan record.Record, 100)
+		handler = Handler{
+			RecordChan: recordChan,
+			Detectors:  parse.Detectors(nil),
+			BatchSize:  parse.DefaultBatchSize,
+			Validation: parse.Validation{Mode: parse.ModeLenient, Reject: parse.RejectFile},
+			Metrics:    metrics.New(),
+		}
+	})
+
+	push := func(method, target string, body []byte, header http.Header) (*httptest.ResponseRecorder, Response) {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		var response Response
+		if recorder.Header().Get("Content-Type") == "application/json" {
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		}
+
+		return recorder, response
+	}
+
+	Describe("pushing documents", func() {
+		Context("when APEL message is pushed", func() {
+			It("should put its records to record channel and accept them", func() {
+				recorder, response := push(http.MethodPost, Path+"?name=vms.apel", apel, nil)
+
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(response.Format).To(Equal(parse.FormatVM))
+				Expect(response.Accepted).To(Equal(10))
+				Expect(response.Rejected).To(BeZero())
+				Expect(response.Records).To(HaveLen(10))
+
+				var rec record.Record
+				Expect(recordChan).To(Receive(&rec))
+				vms, ok := rec.(record.VMs)
+				Expect(ok).To(BeTrue())
+				Expect(vms.VMs).To(HaveLen(10))
+				Expect(vms.Source).To(HaveSuffix("/vms.apel"))
+
+				Expect(testutil.ToFloat64(handler.Metrics.FilesParsed.WithLabelValues(parse.FormatVM))).To(Equal(1.0))
+			})
+		})
+
+		Context("when record has a problem in strict validation mode", func() {
+			It("should reject only the record", func() {
+				handler.Validation = parse.Validation{Mode: parse.ModeStrict, Reject: parse.RejectRecord}
+				recorder, response := push(http.MethodPost, Path+"?format="+parse.FormatIP, ips, nil)
+
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(response.Accepted).To(Equal(1))
+				Expect(response.Rejected).To(Equal(1))
+				Expect(response.Records[0].Accepted).To(BeTrue())
+				Expect(response.Records[1].Accepted).To(BeFalse())
+				Expect(response.Records[1].Problems).To(ConsistOf(Problem{Field: "LocalUser",
+					Reason: parse.ReasonMissing}))
+			})
+		})
+
+		Context("when record has a problem and the whole document is rejected", func() {
+			It("should reject all records", func() {
+				handler.Validation = parse.Validation{Mode: parse.ModeStrict, Reject: parse.RejectFile}
+				recorder, response := push(http.MethodPost, Path+"?format="+parse.FormatIP, ips, nil)
+
+				Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(response.Accepted).To(BeZero())
+				Expect(response.Rejected).To(Equal(2))
+				Expect(response.Error).NotTo(BeEmpty())
+				Expect(recordChan).NotTo(Receive())
+			})
+		})
+
+		Context("when record has a problem in lenient validation mode", func() {
+			It("should accept the record and report its problem", func() {
+				_, response := push(http.MethodPost, Path+"?format="+parse.FormatIP, ips, nil)
+
+				Expect(response.Accepted).To(Equal(2))
+				Expect(response.Records[1].Problems).To(HaveLen(1))
+			})
+		})
+
+		Context("when document type is unknown", func() {
+			It("should respond with unsupported media type", func() {
+				recorder, response := push(http.MethodPost, Path, []byte{0x00, 0x01, 0x02, 0x03}, nil)
+
+				Expect(recorder.Code).To(Equal(http.StatusUnsupportedMediaType))
+				Expect(response.Format).To(Equal(parse.FormatUnknown))
+				Expect(recordChan).NotTo(Receive())
+			})
+		})
+
+		Context("when method is not POST", func() {
+			It("should respond with method not allowed", func() {
+				recorder, _ := push(http.MethodGet, Path, nil, nil)
+
+				Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+
+	Describe("authenticating requests", func() {
+		BeforeEach(func() {
+			handler.Token = "secret"
+		})
+
+		Context("when bearer token is missing or wrong", func() {
+			It("should respond with unauthorized", func() {
+				for _, header := range []http.Header{nil, {"Authorization": {"Bearer wrong"}}} {
+					recorder, _ := push(http.MethodPost, Path, apel, header)
+
+					Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+				}
+				Expect(recordChan).NotTo(Receive())
+			})
+		})
+
+		Context("when bearer token is correct", func() {
+			It("should accept records", func() {
+				recorder, response := push(http.MethodPost, Path, apel, http.Header{"Authorization": {"Bearer secret"}})
+
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(response.Accepted).To(Equal(10))
+			})
+		})
+	})
+})
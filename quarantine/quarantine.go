@@ -0,0 +1,224 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sidecarExt is the extension of files describing quarantined files.
+const sidecarExt = ".json"
+
+// ErrQuarantined is returned by Put when the same version of a file is already in quarantine.
+var ErrQuarantined = errors.New("file already quarantined")
+
+// Entry describes a quarantined file. ModTime is the modification time of the source file when it was quarantined.
+type Entry struct {
+	Name    string    `json:"name"`
+	Source  string    `json:"source"`
+	ModTime time.Time `json:"mod_time"`
+	Type    string    `json:"type"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
+}
+
+// Quarantine keeps files which could not be processed in a directory given by Path.
+// Every quarantined file is accompanied by a sidecar JSON file describing the failure.
+// Files are copied to quarantine, or moved when Move is set.
+type Quarantine struct {
+	Path string
+	Move bool
+}
+
+// Put puts a given file to quarantine with a detected type and an error which caused the failure.
+// A copied file is put to quarantine only once, when a file with the same source path and modification time
+// is already quarantined, its entry is returned together with ErrQuarantined.
+func (q Quarantine) Put(source, fileType string, cause error) (Entry, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if !q.Move {
+		entry, ok, err := q.find(source, info.ModTime())
+		if err != nil {
+			return Entry{}, err
+		}
+		if ok {
+			return entry, ErrQuarantined
+		}
+	}
+
+	now := time.Now()
+	entry := Entry{
+		Name:    fmt.Sprintf("%d_%s", now.UnixNano(), filepath.Base(source)),
+		Source:  source,
+		ModTime: info.ModTime(),
+		Type:    fileType,
+		Error:   cause.Error(),
+		Time:    now,
+	}
+
+	if err = os.MkdirAll(q.Path, 0700); err != nil {
+		return Entry{}, err
+	}
+
+	if q.Move {
+		err = move(source, q.file(entry.Name))
+	} else {
+		err = copyFile(source, q.file(entry.Name))
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return entry, ioutil.WriteFile(q.file(entry.Name)+sidecarExt, data, 0600)
+}
+
+// List lists quarantined files from the oldest.
+func (q Quarantine) List() ([]Entry, error) {
+	files, err := ioutil.ReadDir(q.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(files))
+	for _, fi := range files {
+		names[fi.Name()] = !fi.IsDir()
+	}
+
+	var entries []Entry
+	for _, fi := range files {
+		name := strings.TrimSuffix(fi.Name(), sidecarExt)
+		if fi.IsDir() || name == fi.Name() || !names[name] { // a quarantined JSON file is not a sidecar
+			continue
+		}
+
+		entry, err := q.entry(name)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// Replay writes a quarantined file given by name back to its source path, so it is processed again,
+// and removes it from quarantine. The file is renamed into place to be processed only once written.
+func (q Quarantine) Replay(name string) (Entry, error) {
+	entry, err := q.entry(name)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(entry.Source), 0700); err != nil {
+		return Entry{}, err
+	}
+
+	tmp := filepath.Join(filepath.Dir(entry.Source), "."+entry.Name)
+	if err = copyFile(q.file(name), tmp); err != nil {
+		return Entry{}, err
+	}
+
+	if err = os.Rename(tmp, entry.Source); err != nil {
+		return Entry{}, err
+	}
+
+	if err = os.Remove(q.file(name)); err != nil {
+		return Entry{}, err
+	}
+
+	return entry, os.Remove(q.file(name) + sidecarExt)
+}
+
+// find returns a quarantined file with a given source path and modification time.
+func (q Quarantine) find(source string, modTime time.Time) (Entry, bool, error) {
+	entries, err := q.List()
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	for _, entry := range entries {
+		if entry.Source == source && entry.ModTime.Equal(modTime) {
+			return entry, true, nil
+		}
+	}
+
+	return Entry{}, false, nil
+}
+
+func (q Quarantine) entry(name string) (Entry, error) {
+	data, err := ioutil.ReadFile(q.file(name) + sidecarExt)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	err = json.Unmarshal(data, &entry)
+
+	return entry, err
+}
+
+func (q Quarantine) file(name string) string {
+	return filepath.Join(q.Path, filepath.Base(name))
+}
+
+// move renames a file, or copies and removes it when rename is not possible (e.g. another device).
+func move(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := in.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	out, err := os.OpenFile(filepath.Clean(dst), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+
+	return err
+}
@@ -0,0 +1,162 @@
+package quarantine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Quarantine Suite")
+}
+
+var _ = Describe("Quarantine tests", func() {
+	var (
+		dir    string
+		source string
+		q      Quarantine
+	)
+
+	cause := errors.New("unknown file type")
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "quarantine-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		source = filepath.Join(dir, "records", "vms.apel")
+		Expect(os.MkdirAll(filepath.Dir(source), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(source, []byte("content"), 0600)).To(Succeed())
+
+		q = Quarantine{Path: filepath.Join(dir, "quarantine")}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("putting file", func() {
+		Context("when file is copied", func() {
+			It("should keep the source and write the file with its description", func() {
+				entry, err := q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entry.Name).To(HaveSuffix("_vms.apel"))
+				Expect(entry.Source).To(Equal(source))
+				Expect(entry.Type).To(Equal("vm"))
+				Expect(entry.Error).To(Equal(cause.Error()))
+
+				Expect(source).To(BeAnExistingFile())
+				Expect(ioutil.ReadFile(filepath.Join(q.Path, entry.Name))).To(Equal([]byte("content")))
+				Expect(filepath.Join(q.Path, entry.Name+sidecarExt)).To(BeAnExistingFile())
+			})
+		})
+
+		Context("when file is moved", func() {
+			It("should remove the source", func() {
+				q.Move = true
+
+				entry, err := q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(source).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(q.Path, entry.Name)).To(BeAnExistingFile())
+			})
+		})
+
+		Context("when the same file is copied again", func() {
+			It("should not quarantine it twice", func() {
+				first, err := q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+
+				entry, err := q.Put(source, "vm", cause)
+				Expect(err).To(Equal(ErrQuarantined))
+				Expect(entry.Name).To(Equal(first.Name))
+
+				Expect(q.List()).To(HaveLen(1))
+			})
+		})
+
+		Context("when a modified file is copied again", func() {
+			It("should quarantine it again", func() {
+				_, err := q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+
+				modified := time.Now().Add(time.Minute)
+				Expect(os.Chtimes(source, modified, modified)).To(Succeed())
+
+				_, err = q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(q.List()).To(HaveLen(2))
+			})
+		})
+
+		Context("when file does not exist", func() {
+			It("should return an error", func() {
+				_, err := q.Put(filepath.Join(dir, "missing"), "vm", cause)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("listing files", func() {
+		Context("when quarantine does not exist", func() {
+			It("should return no entries", func() {
+				entries, err := q.List()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(BeEmpty())
+			})
+		})
+
+		Context("when files are quarantined", func() {
+			It("should list them from the oldest", func() {
+				other := filepath.Join(dir, "records", "ips.json")
+				Expect(ioutil.WriteFile(other, []byte("{}"), 0600)).To(Succeed())
+
+				first, err := q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+				second, err := q.Put(other, "ip", cause)
+				Expect(err).NotTo(HaveOccurred())
+
+				entries, err := q.List()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[0].Name).To(Equal(first.Name))
+				Expect(entries[1].Name).To(Equal(second.Name))
+				Expect(entries[1].Type).To(Equal("ip"))
+			})
+		})
+	})
+
+	Describe("replaying file", func() {
+		Context("when file is quarantined", func() {
+			It("should write it back to its source and remove it from quarantine", func() {
+				q.Move = true
+				entry, err := q.Put(source, "vm", cause)
+				Expect(err).NotTo(HaveOccurred())
+
+				replayed, err := q.Replay(entry.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(replayed.Source).To(Equal(source))
+
+				Expect(ioutil.ReadFile(source)).To(Equal([]byte("content")))
+				Expect(q.List()).To(BeEmpty())
+				Expect(filepath.Join(q.Path, entry.Name)).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when file is not quarantined", func() {
+			It("should return an error", func() {
+				_, err := q.Replay("missing")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -1,5 +1,17 @@
 package record
 
+// Kinds of records.
+const (
+	KindVM      = "vm"
+	KindIP      = "ip"
+	KindStorage = "st"
+	KindRetired = "retired"
+)
+
 // Record represents vm/ip/storage record.
 type Record interface {
+	// Kind returns kind of records, it identifies gauges exporting them.
+	Kind() string
+	// Len returns the number of records.
+	Len() int
 }
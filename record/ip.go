@@ -15,6 +15,18 @@ type IP struct {
 }
 
 // IPs represents Ips structure parsed from JSON where IP records are wrapped.
+// Source is the file the records were parsed from.
 type IPs struct {
-	Ips []IP
+	Ips    []IP
+	Source string `json:"-"`
+}
+
+// Kind returns kind of records.
+func (r IPs) Kind() string {
+	return KindIP
+}
+
+// Len returns the number of records.
+func (r IPs) Len() int {
+	return len(r.Ips)
 }
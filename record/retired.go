@@ -0,0 +1,16 @@
+package record
+
+// Retired represents records of a source file which was removed or renamed.
+type Retired struct {
+	Source string
+}
+
+// Kind returns kind of records.
+func (r Retired) Kind() string {
+	return KindRetired
+}
+
+// Len returns the number of records, retired records contain none.
+func (r Retired) Len() int {
+	return 0
+}
@@ -14,7 +14,7 @@ type Storage struct {
 	StorageShare              *string   `xml:"STORAGE_SHARE"`
 	StorageMedia              *string   `xml:"STORAGE_MEDIA"`
 	StorageClass              *string   `xml:"STORAGE_CLASS"`
-	FileCount                 *string   `xml:"FILE_COUNT"`
+	FileCount                 *uint64   `xml:"-"` // parsed from FILE_COUNT, so invalid values are reported
 	DirectoryPath             *string   `xml:"DIRECTORY_PATH"`
 	LocalUser                 *string   `xml:"LOCAL_USER"`
 	LocalGroup                *string   `xml:"LOCAL_GROUP"`
@@ -30,7 +30,19 @@ type Storage struct {
 }
 
 // Storages represents storages structure parsed from XML where storage records are wrapped.
+// Source is the file the records were parsed from.
 type Storages struct {
 	XMLName  xml.Name  `xml:"STORAGES"`
 	Storages []Storage `xml:"STORAGE"`
+	Source   string    `xml:"-"`
+}
+
+// Kind returns kind of records.
+func (r Storages) Kind() string {
+	return KindStorage
+}
+
+// Len returns the number of records.
+func (r Storages) Len() int {
+	return len(r.Storages)
 }
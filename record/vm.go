@@ -1,5 +1,7 @@
 package record
 
+import "time"
+
 // VM represents parsed vm/server record.
 type VM struct {
 	VMUUID              string
@@ -11,11 +13,11 @@ type VM struct {
 	GlobalUserName      *string
 	Fqan                *string
 	Status              *string
-	StartTime           *string
-	EndTime             *string
-	SuspendDuration     *string
-	WallDuration        *string
-	CPUDuration         *string
+	StartTime           *time.Time
+	EndTime             *time.Time
+	SuspendDuration     *time.Duration
+	WallDuration        *time.Duration
+	CPUDuration         *time.Duration
 	CPUCount            uint32
 	NetworkType         *string
 	NetworkInbound      *uint64
@@ -28,9 +30,23 @@ type VM struct {
 	StorageRecordID     *string
 	ImageID             *string
 	CloudType           *string
+	AcceleratorCount    *uint64
+	AcceleratorType     *string
 }
 
 // VMs represents vms structure parsed from APEL template where virtual machine/server records are wrapped.
+// Source is the file the records were parsed from.
 type VMs struct {
-	VMs []VM
+	VMs    []VM
+	Source string
+}
+
+// Kind returns kind of records.
+func (r VMs) Kind() string {
+	return KindVM
+}
+
+// Len returns the number of records.
+func (r VMs) Len() int {
+	return len(r.VMs)
 }
@@ -1,13 +1,19 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/goat-project/exporter/export"
+	"github.com/goat-project/exporter/ledger"
+	"github.com/goat-project/exporter/metrics"
+	"github.com/goat-project/exporter/push"
+	"github.com/goat-project/exporter/quarantine"
 	"github.com/goat-project/exporter/record"
 
 	"github.com/goat-project/exporter/parse"
@@ -19,32 +25,44 @@ import (
 	"github.com/goat-project/exporter/gauge"
 
 	"github.com/goat-project/exporter/constants"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-// Serve accountable to Prometheus.
-func Serve() {
-	eventChan := make(chan fsnotify.Event)
-	recordChan := make(chan record.Record)
+// channelSize is the capacity of event and record channels.
+const channelSize = 100
 
-	exportFinished := make(chan bool, 1)
+// pipeline holds channels and goroutines of the exporter, events flow from producers (watcher, pollers
+// and backfill) through the settler and the parser to records exported by the exporter.
+type pipeline struct {
+	eventChan      chan fsnotify.Event
+	recordChan     chan record.Record
+	exportFinished chan bool
+	settlerIn      chan fsnotify.Event
 
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	// producers are goroutines which add events or records to the channels, the channels are closed
+	// only after all of them stopped
+	producers, settlers, parsers sync.WaitGroup
 
-	go func() {
-		sig := <-signalChan
-		fmt.Println()
-		fmt.Println(sig)
+	instrumentation *metrics.Metrics
+	roots           watch.Roots
+	mode            string
+	parser          *parse.Parser
+	watcher         watch.Watcher
+	gauges          *gauge.Gauge
+	rollups         *export.Rollups
+	exporter        *export.Exporter
+}
 
-		close(eventChan)
-		close(recordChan)
+// Serve accountable to Prometheus.
+func Serve() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-		<-exportFinished
-		os.Exit(0)
-	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -60,31 +78,325 @@ func Serve() {
 		}
 	}()
 
-	parser := parse.SetParser(eventChan, recordChan)
+	p := &pipeline{
+		eventChan:       make(chan fsnotify.Event, channelSize),
+		recordChan:      make(chan record.Record, channelSize),
+		exportFinished:  make(chan bool, 1),
+		instrumentation: metrics.New(),
+	}
 
-	watcher := watch.Watcher{
+	registry := newRegistry()
+	if !p.configureParser() || !p.configureWatch(w) || !p.configureExport(registry) {
+		return
+	}
+
+	p.startJanitors()
+	p.startConsumers()
+	p.startProducers(ctx)
+
+	server := &http.Server{Addr: viper.GetString(constants.CfgPrometheusEndpoint), Handler: p.handler(registry)}
+	stopped := make(chan struct{})
+
+	go func() {
+		sig := <-signalChan
+		fmt.Println()
+		fmt.Println(sig)
+
+		// stop producers first, so nothing is added to the channels when they are closed
+		cancel()
+		if err := server.Shutdown(context.Background()); err != nil {
+			logrus.WithField("error", err).Error("error shut down server")
+		}
+		p.shutdown()
+
+		close(stopped)
+	}()
+
+	if err = server.ListenAndServe(); err != http.ErrServerClosed {
+		logrus.WithFields(logrus.Fields{"error": err,
+			"endpoint": viper.GetString(constants.CfgPrometheusEndpoint)}).Fatal("error listen and serve")
+	}
+
+	<-stopped
+}
+
+// configureParser configures the parser of events, its detectors, validation, roots, ledger and quarantine.
+func (p *pipeline) configureParser() bool {
+	p.parser = parse.SetParser(p.eventChan, p.recordChan)
+	p.parser.Metrics = p.instrumentation
+
+	var patterns []parse.Pattern
+	if err := viper.UnmarshalKey(constants.CfgDetectPatterns, &patterns); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error read detect patterns")
+		return false
+	}
+	p.parser.Detectors = parse.Detectors(patterns)
+	p.parser.BatchSize = viper.GetInt(constants.CfgBatchSize)
+
+	p.parser.Validation = parse.Validation{
+		Mode:   viper.GetString(constants.CfgValidationMode),
+		Reject: viper.GetString(constants.CfgValidationReject),
+	}
+	if err := p.parser.Validation.Validate(); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error read validation")
+		return false
+	}
+
+	roots, err := readRoots()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error read roots")
+		return false
+	}
+	p.roots = roots
+	p.parser.Roots = roots
+
+	if path := viper.GetString(constants.CfgLedgerPath); path != "" {
+		p.parser.Ledger, err = ledger.Open(path)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "file": path}).Error("error open ledger")
+			return false
+		}
+	}
+
+	if path := viper.GetString(constants.CfgQuarantinePath); path != "" {
+		p.parser.Quarantine = &quarantine.Quarantine{
+			Path: path,
+			Move: viper.GetBool(constants.CfgQuarantineMove),
+		}
+	}
+
+	return true
+}
+
+// configureWatch configures the watcher and the settler of its events and adds roots to the watcher
+// unless they are only polled.
+func (p *pipeline) configureWatch(w *fsnotify.Watcher) bool {
+	p.watcher = watch.Watcher{
 		Watcher:   w,
-		EventChan: eventChan,
+		EventChan: p.eventChan,
+		Ops:       fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename,
 	}
 
-	err = watcher.AddRootWithSubDirs(viper.GetString(constants.CfgDirectoryPath))
+	if quiet := viper.GetDuration(constants.CfgSettleInterval); quiet > 0 {
+		settler := watch.Settler{
+			In:    make(chan fsnotify.Event),
+			Out:   p.eventChan,
+			Quiet: quiet,
+		}
+
+		p.settlerIn = settler.In
+		p.watcher.EventChan = settler.In
+
+		p.settlers.Add(1)
+		go func() {
+			defer p.settlers.Done()
+			settler.Settle()
+		}()
+	}
+
+	p.mode = viper.GetString(constants.CfgWatchMode)
+	switch p.mode {
+	case watch.ModeInotify, watch.ModePoll, watch.ModeHybrid:
+	default:
+		logrus.WithField("mode", p.mode).Error("unknown watch mode")
+		return false
+	}
+
+	if p.mode != watch.ModePoll {
+		for _, root := range p.roots {
+			if err := p.watcher.AddRootWithSubDirs(root.Path); err != nil {
+				logrus.WithFields(logrus.Fields{"error": err, "dir": root.Path}).Error("error add directory")
+			}
+		}
+	}
+
+	return true
+}
+
+// configureExport creates gauges and rollups, registers them with metrics of the exporter to the registry
+// and creates the exporter of records.
+func (p *pipeline) configureExport(registry *prometheus.Registry) bool {
+	p.gauges = gauge.CreateAll(registry, p.instrumentation)
+
+	var labels map[string]gauge.LabelConfig
+	if err := viper.UnmarshalKey(constants.CfgGaugeLabels, &labels); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error read gauge labels")
+		return false
+	}
+	static := gauge.StaticLabels{Names: p.roots.LabelNames(), Values: p.roots.Labels}
+	if err := p.gauges.Configure(viper.GetString(constants.CfgMetricNames), labels, static); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error configure gauges")
+		return false
+	}
+	p.gauges.RegistryAll()
+
+	p.instrumentation.Register(registry)
+	metrics.RegisterBacklog(registry, "event", func() int { return len(p.eventChan) })
+	metrics.RegisterBacklog(registry, "record", func() int { return len(p.recordChan) })
+
+	var rollupConfigs []export.RollupConfig
+	if err := viper.UnmarshalKey(constants.CfgRollups, &rollupConfigs); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error read rollups")
+		return false
+	}
+	rollups, err := export.NewRollups(rollupConfigs, p.gauges, static)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"error": err, "dir": viper.GetString(constants.CfgDirectoryPath)}).Error(
-			"error add directory")
+		logrus.WithFields(logrus.Fields{"error": err}).Error("error create rollups")
+		return false
 	}
+	registry.MustRegister(rollups)
+	p.rollups = rollups
 
-	gauges := gauge.CreateAll()
-	gauges.RegistryAll()
+	p.exporter = export.CreateExporter(p.recordChan, p.gauges)
+	p.exporter.Rollups = rollups
+	p.exporter.Metrics = p.instrumentation
 
-	exporter := export.CreateExporter(recordChan, gauges)
+	return true
+}
 
-	go parser.Parse()
-	go watcher.Watch()
-	go exporter.Export(exportFinished)
+// startJanitors starts janitors removing expired series of gauges and rollups.
+func (p *pipeline) startJanitors() {
+	ttl := gauge.TTL{}
+	for _, kind := range p.gauges.Kinds() {
+		ttl[kind] = viper.GetDuration(constants.CfgTTL + "." + kind)
+	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	if err = http.ListenAndServe(viper.GetString(constants.CfgPrometheusEndpoint), nil); err != nil {
-		logrus.WithFields(logrus.Fields{"error": err,
-			"endpoint": viper.GetString(constants.CfgPrometheusEndpoint)}).Fatal("error listen and serve")
+	go p.gauges.Janitor(viper.GetDuration(constants.CfgJanitorInterval), ttl)
+	go p.rollups.Janitor(viper.GetDuration(constants.CfgJanitorInterval), ttl)
+}
+
+// startConsumers starts the parser of events and the exporter of records.
+func (p *pipeline) startConsumers() {
+	p.parsers.Add(1)
+	go func() {
+		defer p.parsers.Done()
+		p.parser.Parse()
+	}()
+	go p.exporter.Export(p.exportFinished)
+}
+
+// startProducers starts the watcher and pollers of roots according to the watch mode, and restores
+// and backfills existing files. Producers stop when the context is canceled.
+func (p *pipeline) startProducers(ctx context.Context) {
+	if p.mode != watch.ModePoll {
+		p.producers.Add(1)
+		go func() {
+			defer p.producers.Done()
+			p.watcher.Watch(ctx)
+		}()
+	}
+
+	if p.mode != watch.ModeInotify {
+		for _, root := range p.roots {
+			poller := watch.Poller{
+				Root:      root.Path,
+				EventChan: p.watcher.EventChan,
+				Interval:  viper.GetDuration(constants.CfgPollInterval),
+				Ops:       p.watcher.Ops,
+			}
+
+			p.producers.Add(1)
+			go func() {
+				defer p.producers.Done()
+				poller.Poll(ctx)
+			}()
+		}
+	}
+
+	p.producers.Add(1)
+	go func() {
+		defer p.producers.Done()
+		p.parser.Restore()
+
+		if viper.GetBool(constants.CfgBackfill) {
+			for _, root := range p.roots {
+				if ctx.Err() != nil {
+					return
+				}
+
+				backfill(p.eventChan, root.Path)
+			}
+		}
+	}()
+}
+
+// handler serves metrics of the registry and pushed records when push is enabled.
+func (p *pipeline) handler(registry *prometheus.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	if viper.GetBool(constants.CfgPush) {
+		mux.Handle(push.Path, push.Handler{
+			RecordChan: p.recordChan,
+			Detectors:  p.parser.Detectors,
+			BatchSize:  p.parser.BatchSize,
+			Validation: p.parser.Validation,
+			Token:      viper.GetString(constants.CfgPushToken),
+			Metrics:    p.instrumentation,
+		})
+	}
+
+	return mux
+}
+
+// shutdown waits for producers, which have to be stopped before, and then closes the channels in order
+// of the pipeline, so every event and record added before is processed. It returns when all records
+// are exported.
+func (p *pipeline) shutdown() {
+	p.producers.Wait()
+
+	if p.settlerIn != nil {
+		close(p.settlerIn)
+		p.settlers.Wait()
+	}
+
+	close(p.eventChan)
+	p.parsers.Wait()
+
+	if p.parser.Ledger != nil {
+		if err := p.parser.Ledger.Close(); err != nil {
+			logrus.WithField("error", err).Error("error close ledger")
+		}
+	}
+
+	close(p.recordChan)
+	<-p.exportFinished
+}
+
+// newRegistry creates registry for gauges and metrics of the exporter, Go runtime and process
+// metrics are registered only when they are enabled.
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	if viper.GetBool(constants.CfgGoCollector) {
+		registry.MustRegister(prometheus.NewGoCollector())
+	}
+
+	if viper.GetBool(constants.CfgProcessCollector) {
+		registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 	}
+
+	return registry
+}
+
+// backfill adds existing files directly to event channel, they are already written and need no settling.
+func backfill(eventChan chan fsnotify.Event, dir string) {
+	err := watch.Watcher{EventChan: eventChan}.Backfill(dir, viper.GetString(constants.CfgBackfillOrder),
+		viper.GetDuration(constants.CfgBackfillMaxAge))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "dir": dir}).Error("error backfill directory")
+	}
+}
+
+// readRoots reads watched root directories, the directory path is the only root when no roots are configured.
+func readRoots() (watch.Roots, error) {
+	var roots watch.Roots
+	if err := viper.UnmarshalKey(constants.CfgRoots, &roots); err != nil {
+		return nil, err
+	}
+
+	if len(roots) == 0 {
+		roots = watch.Roots{{Path: viper.GetString(constants.CfgDirectoryPath)}}
+	}
+
+	return roots, roots.Validate()
 }
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"fmt"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -20,33 +23,96 @@ func StrToF64(s string) float64 {
 
 // StrToUint64 converts string to *uint64.
 func StrToUint64(s string) *uint64 {
-	return strToUint(s, 64)
+	u, err := ParseUint64(s)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "string": s}).Error("unable to parse string to uint")
+	}
+
+	return u
 }
 
 // StrToUint32 converts string to uint32.
 func StrToUint32(s string) uint32 {
-	c := strToUint(s, 32)
-	if c != nil {
-		return uint32(*c)
+	u, err := ParseUint32(s)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "string": s}).Error("unable to parse string to uint")
 	}
 
-	return 0
+	return u
 }
 
 // StrToFloat32 converts string to *float32.
 func StrToFloat32(s string) *float32 {
+	f, err := ParseFloat32(s)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "string": s}).Error("unable to parse string to float")
+	}
+
+	return f
+}
+
+// ParseUint64 converts string to *uint64. NULL values are converted to nil.
+func ParseUint64(s string) (*uint64, error) {
+	return strToUint(s, 64)
+}
+
+// ParseUint32 converts string to uint32. NULL values are converted to 0.
+func ParseUint32(s string) (uint32, error) {
+	c, err := strToUint(s, 32)
+	if c == nil {
+		return 0, err
+	}
+
+	return uint32(*c), nil
+}
+
+// ParseFloat32 converts string to *float32. NULL values are converted to nil.
+func ParseFloat32(s string) (*float32, error) {
 	if Null(s) {
-		return nil
+		return nil, nil
 	}
 
 	f, err := strconv.ParseFloat(s, 32)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"error": err, "string": s}).Error("unable to parse string to float")
-		return nil
+		return nil, err
 	}
 	ff := float32(f)
 
-	return &ff
+	return &ff, nil
+}
+
+// ParseUnixTime converts string with seconds since epoch to *time.Time. NULL values are converted to nil.
+func ParseUnixTime(s string) (*time.Time, error) {
+	if Null(s) {
+		return nil, nil
+	}
+
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Unix(sec, 0)
+
+	return &t, nil
+}
+
+// ParseSeconds converts string with number of seconds to *time.Duration. NULL values are converted to nil.
+func ParseSeconds(s string) (*time.Duration, error) {
+	if Null(s) {
+		return nil, nil
+	}
+
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if sec > math.MaxInt64/int64(time.Second) || sec < math.MinInt64/int64(time.Second) {
+		return nil, fmt.Errorf("duration %s seconds out of range", s)
+	}
+	d := time.Duration(sec) * time.Second
+
+	return &d, nil
 }
 
 // String converts string to *string.
@@ -63,16 +129,15 @@ func Null(s string) bool {
 	return s == "" || s == "NULL" || s == "null" || s == "nil" || s == "<nil>"
 }
 
-func strToUint(s string, bitSize int) *uint64 {
+func strToUint(s string, bitSize int) (*uint64, error) {
 	if Null(s) {
-		return nil
+		return nil, nil
 	}
 
 	u, err := strconv.ParseUint(s, 10, bitSize)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"error": err, "string": s}).Error("unable to parse string to uint")
-		return nil
+		return nil, err
 	}
 
-	return &u
+	return &u, nil
 }
@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Backfill orders.
+const (
+	// OrderMtime orders files from the oldest to the newest modification time.
+	OrderMtime = "mtime"
+	// OrderName orders files lexically by path.
+	OrderName = "name"
+)
+
+type file struct {
+	path    string
+	modTime time.Time
+}
+
+// Backfill walks root and its subdirectories the same way as AddRootWithSubDirs and adds every
+// file already present there to event channel as if it was just written. Files are sent in a given
+// order (OrderMtime or OrderName). Files modified more than maxAge ago are skipped, zero maxAge
+// means no limit.
+func (w Watcher) Backfill(root, order string, maxAge time.Duration) error {
+	if err := ValidateOrder(order); err != nil {
+		return err
+	}
+
+	var files []file
+
+	now := time.Now()
+	err := walk(root, func(path string, info os.FileInfo) error {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if maxAge > 0 && now.Sub(info.ModTime()) > maxAge {
+			logrus.WithFields(logrus.Fields{"file": path, "modified": info.ModTime()}).Debug(
+				"file too old for backfill")
+			return nil
+		}
+
+		files = append(files, file{path: path, modTime: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sortFiles(files, order)
+
+	for _, f := range files {
+		w.EventChan <- fsnotify.Event{Name: f.path, Op: fsnotify.Write}
+	}
+
+	logrus.WithFields(logrus.Fields{"dir": root, "files": len(files)}).Debug("backfill finished")
+
+	return nil
+}
+
+// ValidateOrder returns an error if a given backfill order is unknown.
+func ValidateOrder(order string) error {
+	switch order {
+	case OrderMtime, OrderName:
+		return nil
+	default:
+		return fmt.Errorf("unknown backfill order: %s", order)
+	}
+}
+
+func sortFiles(files []file, order string) {
+	switch order {
+	case OrderName:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].path < files[j].path
+		})
+	case OrderMtime:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].modTime.Before(files[j].modTime)
+		})
+	}
+}
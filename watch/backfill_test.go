@@ -0,0 +1,102 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backfill tests", func() {
+	dirPath := "/tmp/goat/backfill-test"
+
+	var watcher Watcher
+
+	BeforeEach(func() {
+		watcher = Watcher{
+			EventChan: make(chan fsnotify.Event, 10),
+		}
+
+		Expect(os.MkdirAll(filepath.Join(dirPath, "a"), 0700)).NotTo(HaveOccurred())
+
+		now := time.Now()
+		files := map[string]time.Time{
+			"c":   now.Add(-3 * time.Hour),
+			"a/b": now.Add(-2 * time.Hour),
+			"a/a": now.Add(-time.Hour),
+		}
+
+		for name, modTime := range files {
+			path := filepath.Join(dirPath, name)
+			Expect(ioutil.WriteFile(path, []byte("data"), 0600)).NotTo(HaveOccurred())
+			Expect(os.Chtimes(path, modTime, modTime)).NotTo(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dirPath)).NotTo(HaveOccurred())
+	})
+
+	received := func() []string {
+		var names []string
+		for len(watcher.EventChan) > 0 {
+			event := <-watcher.EventChan
+			Expect(event.Op).To(Equal(fsnotify.Write))
+			names = append(names, event.Name)
+		}
+
+		return names
+	}
+
+	Describe("backfilling directory", func() {
+		Context("when no such directory", func() {
+			It("should return an error", func() {
+				Expect(watcher.Backfill(dirPath+"-missing", OrderName, 0)).To(HaveOccurred())
+			})
+		})
+
+		Context("when ordered by name", func() {
+			It("should send all files sorted by path", func() {
+				Expect(watcher.Backfill(dirPath, OrderName, 0)).NotTo(HaveOccurred())
+				Expect(received()).To(Equal([]string{
+					filepath.Join(dirPath, "a/a"),
+					filepath.Join(dirPath, "a/b"),
+					filepath.Join(dirPath, "c"),
+				}))
+			})
+		})
+
+		Context("when ordered by modification time", func() {
+			It("should send all files from the oldest", func() {
+				Expect(watcher.Backfill(dirPath, OrderMtime, 0)).NotTo(HaveOccurred())
+				Expect(received()).To(Equal([]string{
+					filepath.Join(dirPath, "c"),
+					filepath.Join(dirPath, "a/b"),
+					filepath.Join(dirPath, "a/a"),
+				}))
+			})
+		})
+
+		Context("when max age is set", func() {
+			It("should skip older files", func() {
+				Expect(watcher.Backfill(dirPath, OrderMtime, 150*time.Minute)).NotTo(HaveOccurred())
+				Expect(received()).To(Equal([]string{
+					filepath.Join(dirPath, "a/b"),
+					filepath.Join(dirPath, "a/a"),
+				}))
+			})
+		})
+
+		Context("when order is unknown", func() {
+			It("should return an error without sending files", func() {
+				Expect(watcher.Backfill(dirPath, "size", 0)).To(HaveOccurred())
+				Expect(watcher.EventChan).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package watch
+
+import "os"
+
+// inode returns zero, inode numbers are not available, so replaced files are recognized by size
+// and modification time only.
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,161 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Watch modes.
+const (
+	// ModeInotify watches files by inotify (fsnotify) only.
+	ModeInotify = "inotify"
+	// ModePoll watches files by periodic scans only.
+	ModePoll = "poll"
+	// ModeHybrid watches files by inotify and periodic scans, so events missed by inotify are found by scans.
+	ModeHybrid = "hybrid"
+)
+
+// DefaultPollInterval is the default period of scans.
+const DefaultPollInterval = 10 * time.Second
+
+// state is the state of a file which changes when the file is written or replaced.
+type state struct {
+	size    int64
+	modTime time.Time
+	inode   uint64
+}
+
+func (s state) equal(other state) bool {
+	return s.size == other.size && s.modTime.Equal(other.modTime) && s.inode == other.inode
+}
+
+// Poller watches files by periodic scans of Root and its subdirectories, so files written on other hosts
+// of network filesystems (e.g. NFS) where inotify reports no events are processed too. A file is new or changed
+// when it was not added yet or its size, modification time or inode differs from the state when it was added.
+// New and changed files are added to event channel as written (fsnotify.Write) once two scans in a row find them
+// in the same state, so a file which is still being written is added only after it has not changed for Interval.
+// Files which disappeared are added as removed (fsnotify.Remove), so the events are the same as events of Watcher.
+// Ops selects file operations added to event channel, only fsnotify.Write is added when Ops is not set. Files
+// already present when polling starts are not added.
+type Poller struct {
+	Root      string
+	EventChan chan fsnotify.Event
+	Interval  time.Duration
+	Ops       fsnotify.Op
+}
+
+// Poll scans Root every Interval (DefaultPollInterval when Interval is not set) until ctx is done.
+func (p Poller) Poll(ctx context.Context) {
+	files, err := scan(p.Root)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "dir": p.Root}).Error("error scan directory")
+	}
+
+	// states of files when they were added to event channel (or found by the first scan)
+	added := make(map[string]state, len(files))
+	for path, s := range files {
+		added[path] = s
+	}
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := scan(p.Root)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "dir": p.Root}).Error("error scan directory")
+			continue // a missing root would remove all files
+		}
+
+		for _, event := range changes(added, files, current) {
+			if event.Op == fsnotify.Write {
+				added[event.Name] = current[event.Name]
+			} else {
+				delete(added, event.Name)
+			}
+
+			if event.Op&p.ops() != 0 {
+				logrus.WithFields(logrus.Fields{"event": event.Name, "op": event.Op}).Debug("polled event")
+				p.EventChan <- event
+			}
+		}
+
+		files = current
+	}
+}
+
+func (p Poller) ops() fsnotify.Op {
+	if p.Ops == 0 {
+		return fsnotify.Write
+	}
+
+	return p.Ops
+}
+
+// scan returns states of all regular files in root and its subdirectories. Files which disappear
+// during the scan are skipped.
+func scan(root string) (map[string]state, error) {
+	files := make(map[string]state)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+
+			return nil
+		}
+
+		if info.Mode().IsRegular() {
+			files[path] = state{size: info.Size(), modTime: info.ModTime(), inode: inode(info)}
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// changes returns events of files which were written or removed since they were added, sorted by path. A written
+// file is returned only when the previous and the current scan found it in the same state.
+func changes(added, previous, current map[string]state) []fsnotify.Event {
+	var events []fsnotify.Event
+	for path, s := range current {
+		if p, ok := previous[path]; !ok || !p.equal(s) {
+			continue // still being written
+		}
+
+		if a, ok := added[path]; !ok || !a.equal(s) {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+
+	for path := range added {
+		if _, ok := current[path]; !ok {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+
+	return events
+}
@@ -0,0 +1,128 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Poller tests", func() {
+	dirPath := "/tmp/goat/poller-test"
+
+	var (
+		poller Poller
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		Expect(os.MkdirAll(filepath.Join(dirPath, "sub"), 0700)).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(dirPath, "old"), []byte("old"), 0600)).NotTo(HaveOccurred())
+
+		poller = Poller{
+			Root:      dirPath,
+			EventChan: make(chan fsnotify.Event, 10),
+			Interval:  10 * time.Millisecond,
+			Ops:       fsnotify.Write | fsnotify.Remove,
+		}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+
+		go poller.Poll(ctx)
+		time.Sleep(5 * time.Millisecond) // let the first scan finish
+	})
+
+	AfterEach(func() {
+		cancel()
+		Expect(os.RemoveAll(dirPath)).NotTo(HaveOccurred())
+	})
+
+	Describe("polling files", func() {
+		Context("when file is created in subdirectory", func() {
+			It("should add written event", func() {
+				name := filepath.Join(dirPath, "sub", "new")
+				Expect(ioutil.WriteFile(name, []byte("new"), 0600)).NotTo(HaveOccurred())
+
+				Eventually(poller.EventChan).Should(Receive(Equal(fsnotify.Event{Name: name, Op: fsnotify.Write})))
+			})
+		})
+
+		Context("when file is changed", func() {
+			It("should add written event", func() {
+				name := filepath.Join(dirPath, "old")
+				Expect(ioutil.WriteFile(name, []byte("changed"), 0600)).NotTo(HaveOccurred())
+
+				Eventually(poller.EventChan).Should(Receive(Equal(fsnotify.Event{Name: name, Op: fsnotify.Write})))
+			})
+		})
+
+		Context("when file is replaced by another file of the same size and time", func() {
+			It("should add written event", func() {
+				name := filepath.Join(dirPath, "old")
+				info, err := os.Stat(name)
+				Expect(err).NotTo(HaveOccurred())
+
+				replacement := filepath.Join(dirPath, "replacement")
+				Expect(ioutil.WriteFile(replacement, []byte("new"), 0600)).NotTo(HaveOccurred())
+				Expect(os.Chtimes(replacement, info.ModTime(), info.ModTime())).NotTo(HaveOccurred())
+				Expect(os.Rename(replacement, name)).NotTo(HaveOccurred())
+
+				Eventually(poller.EventChan).Should(Receive(Equal(fsnotify.Event{Name: name, Op: fsnotify.Write})))
+			})
+		})
+
+		Context("when file is removed", func() {
+			It("should add removed event", func() {
+				name := filepath.Join(dirPath, "old")
+				Expect(os.Remove(name)).NotTo(HaveOccurred())
+
+				Eventually(poller.EventChan).Should(Receive(Equal(fsnotify.Event{Name: name, Op: fsnotify.Remove})))
+			})
+		})
+
+		Context("when nothing changes", func() {
+			It("should not add files already present", func() {
+				Consistently(poller.EventChan, 50*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("finding changes", func() {
+		Context("when file grows across scans", func() {
+			It("should add written event once two scans find the same state", func() {
+				name := filepath.Join(dirPath, "growing")
+				modTime := time.Now()
+				added := map[string]state{}
+				scans := []map[string]state{
+					{name: {size: 10, modTime: modTime, inode: 1}},
+					{name: {size: 20, modTime: modTime.Add(time.Second), inode: 1}},
+					{name: {size: 30, modTime: modTime.Add(2 * time.Second), inode: 1}},
+					{name: {size: 30, modTime: modTime.Add(2 * time.Second), inode: 1}},
+				}
+
+				for i := 1; i < len(scans)-1; i++ {
+					Expect(changes(added, scans[i-1], scans[i])).To(BeEmpty())
+				}
+
+				Expect(changes(added, scans[2], scans[3])).To(Equal([]fsnotify.Event{{Name: name, Op: fsnotify.Write}}))
+
+				added[name] = scans[3][name]
+				Expect(changes(added, scans[3], scans[3])).To(BeEmpty())
+			})
+		})
+
+		Context("when file disappears before it is added", func() {
+			It("should not add removed event", func() {
+				name := filepath.Join(dirPath, "temporary")
+				Expect(changes(map[string]state{}, map[string]state{name: {size: 1}}, map[string]state{})).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package watch
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelName is a valid name of a Prometheus label.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Root is a watched root directory. Only files matching any of Include patterns (all files when there are none)
+// and no Exclude pattern are processed. Patterns are globs matched against the base name of a file, patterns
+// with a path separator are matched against the path relative to the root. Format is the format of all records
+// of the root, empty Format means the format is detected. Labels are attached to all series of records
+// from the root.
+type Root struct {
+	Path    string            `mapstructure:"path"`
+	Include []string          `mapstructure:"include"`
+	Exclude []string          `mapstructure:"exclude"`
+	Format  string            `mapstructure:"format"`
+	Labels  map[string]string `mapstructure:"labels"`
+}
+
+// Roots are watched root directories.
+type Roots []Root
+
+// Validate returns an error if a root has no path, an invalid pattern or an invalid label name.
+func (roots Roots) Validate() error {
+	for _, root := range roots {
+		if root.Path == "" {
+			return fmt.Errorf("root without path")
+		}
+
+		for _, pattern := range append(append([]string(nil), root.Include...), root.Exclude...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("root %s: invalid pattern %q: %v", root.Path, pattern, err)
+			}
+		}
+
+		for name := range root.Labels {
+			if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("root %s: invalid label name: %s", root.Path, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Find returns the innermost root containing a given path, false if no root contains it.
+func (roots Roots) Find(path string) (Root, bool) {
+	var found Root
+	ok := false
+	for _, root := range roots {
+		if root.contains(path) && (!ok || len(root.Path) > len(found.Path)) {
+			found, ok = root, true
+		}
+	}
+
+	return found, ok
+}
+
+// Match checks if a file with a given path is processed, all files are processed when there are no roots.
+func (roots Roots) Match(path string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+
+	root, ok := roots.Find(path)
+
+	return ok && root.Match(path)
+}
+
+// LabelNames returns sorted names of labels of all roots.
+func (roots Roots) LabelNames() []string {
+	unique := make(map[string]struct{})
+	for _, root := range roots {
+		for name := range root.Labels {
+			unique[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(unique))
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Labels returns labels of the root containing a given path, nil if no root contains it.
+func (roots Roots) Labels(path string) map[string]string {
+	root, ok := roots.Find(path)
+	if !ok {
+		return nil
+	}
+
+	return root.Labels
+}
+
+// Match checks if a file with a given path in the root matches include and exclude patterns.
+func (r Root) Match(path string) bool {
+	if len(r.Include) > 0 && !r.matchAny(r.Include, path) {
+		return false
+	}
+
+	return !r.matchAny(r.Exclude, path)
+}
+
+func (r Root) matchAny(patterns []string, path string) bool {
+	rel, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, pattern := range patterns {
+		name := filepath.Base(path)
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			name = rel
+		}
+
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contains checks if a given path is the root or it is inside the root.
+func (r Root) contains(path string) bool {
+	root := filepath.Clean(r.Path)
+	path = filepath.Clean(path)
+
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+
+		string(filepath.Separator))
+}
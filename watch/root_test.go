@@ -0,0 +1,73 @@
+package watch
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Root tests", func() {
+	roots := Roots{
+		{Path: "/var/goat/site-a", Include: []string{"*.apel", "*.gz"}, Exclude: []string{"tmp/*"},
+			Labels: map[string]string{"instance": "site-a"}},
+		{Path: "/var/goat/site-a/ip", Format: "ip", Labels: map[string]string{"instance": "site-a-ip", "zone": "a"}},
+		{Path: "/var/goat/site-b"},
+	}
+
+	Describe("matching files", func() {
+		Context("when file matches include pattern", func() {
+			It("should be matched in subdirectories too", func() {
+				Expect(roots.Match("/var/goat/site-a/vms.apel")).To(BeTrue())
+				Expect(roots.Match("/var/goat/site-a/2020/vms.apel.gz")).To(BeTrue())
+			})
+		})
+
+		Context("when file matches no include pattern or an exclude pattern", func() {
+			It("should not be matched", func() {
+				Expect(roots.Match("/var/goat/site-a/vms.json")).To(BeFalse())
+				Expect(roots.Match("/var/goat/site-a/tmp/vms.apel")).To(BeFalse())
+			})
+		})
+
+		Context("when file is in no root", func() {
+			It("should not be matched", func() {
+				Expect(roots.Match("/var/goat/site-ab/vms.apel")).To(BeFalse())
+				Expect(Roots(nil).Match("/var/goat/site-ab/vms.apel")).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("finding roots", func() {
+		Context("when roots are nested", func() {
+			It("should find the innermost root", func() {
+				root, ok := roots.Find("/var/goat/site-a/ip/ips.json")
+				Expect(ok).To(BeTrue())
+				Expect(root.Format).To(Equal("ip"))
+				Expect(roots.Match("/var/goat/site-a/ip/ips.json")).To(BeTrue())
+			})
+		})
+
+		Context("when roots have labels", func() {
+			It("should return labels of the root and names of labels of all roots", func() {
+				Expect(roots.Labels("/var/goat/site-a/vms.apel")).To(Equal(map[string]string{"instance": "site-a"}))
+				Expect(roots.Labels("goat://server/vms.apel")).To(BeNil())
+				Expect(roots.LabelNames()).To(Equal([]string{"instance", "zone"}))
+			})
+		})
+	})
+
+	Describe("validating roots", func() {
+		Context("when root is invalid", func() {
+			It("should return an error", func() {
+				for _, root := range []Root{
+					{},
+					{Path: "/var/goat", Include: []string{"["}},
+					{Path: "/var/goat", Labels: map[string]string{"site-a": "a"}},
+					{Path: "/var/goat", Labels: map[string]string{"__name__": "a"}},
+				} {
+					Expect(Roots{root}.Validate()).To(HaveOccurred())
+				}
+				Expect(roots.Validate()).To(Succeed())
+			})
+		})
+	})
+})
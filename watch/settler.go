@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// minTick is the shortest period of checking pending files.
+const minTick = 10 * time.Millisecond
+
+// Settler coalesces events per path between Watcher and Parser. A file is added to Out channel
+// only once no event came for it for the Quiet interval, so a file written in several chunks
+// is parsed once. The fsnotify reports neither closing of files nor files moved into a watched
+// directory separately from created ones, so the end of writing is recognized by the Quiet interval only
+// and created files are settled like written ones, even when they were renamed into place.
+// Other operations than create and write are added immediately and drop pending events for the path.
+type Settler struct {
+	In    chan fsnotify.Event
+	Out   chan fsnotify.Event
+	Quiet time.Duration
+}
+
+// Settle takes events from In channel and adds settled files to Out channel until In channel is closed.
+func (s Settler) Settle() {
+	pending := make(map[string]time.Time) // path -> time of the last event
+
+	ticker := time.NewTicker(s.tick())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-s.In:
+			if !ok {
+				return
+			}
+
+			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				pending[event.Name] = time.Now()
+				continue
+			}
+
+			delete(pending, event.Name)
+			s.Out <- event
+		case now := <-ticker.C:
+			s.flush(pending, now)
+		}
+	}
+}
+
+// flush adds files without event for the Quiet interval to Out channel, the oldest first.
+func (s Settler) flush(pending map[string]time.Time, now time.Time) {
+	var settled []string
+	for path, last := range pending {
+		if now.Sub(last) >= s.Quiet {
+			settled = append(settled, path)
+		}
+	}
+
+	sort.Slice(settled, func(i, j int) bool {
+		return pending[settled[i]].Before(pending[settled[j]])
+	})
+
+	for _, path := range settled {
+		delete(pending, path)
+
+		logrus.WithField("file", path).Debug("file settled")
+		s.Out <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+	}
+}
+
+func (s Settler) tick() time.Duration {
+	if s.Quiet/2 < minTick {
+		return minTick
+	}
+
+	return s.Quiet / 2
+}
@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Settler tests", func() {
+	dirPath := "/tmp/goat/settler-test"
+	quiet := 50 * time.Millisecond
+
+	var settler Settler
+
+	BeforeEach(func() {
+		Expect(os.MkdirAll(dirPath, 0700)).NotTo(HaveOccurred())
+
+		settler = Settler{
+			In:    make(chan fsnotify.Event),
+			Out:   make(chan fsnotify.Event, 10),
+			Quiet: quiet,
+		}
+
+		go settler.Settle()
+	})
+
+	AfterEach(func() {
+		close(settler.In)
+		Expect(os.RemoveAll(dirPath)).NotTo(HaveOccurred())
+	})
+
+	Describe("settling events", func() {
+		Context("when file is written several times", func() {
+			It("should add one event after quiet interval", func() {
+				path := filepath.Join(dirPath, "chunks")
+
+				settler.In <- fsnotify.Event{Name: path, Op: fsnotify.Create}
+				for i := 0; i < 3; i++ {
+					settler.In <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+					time.Sleep(quiet / 5)
+				}
+
+				Consistently(settler.Out, quiet/2).ShouldNot(Receive())
+				Eventually(settler.Out, 4*quiet).Should(Receive(Equal(fsnotify.Event{Name: path, Op: fsnotify.Write})))
+				Consistently(settler.Out, 2*quiet).ShouldNot(Receive())
+			})
+		})
+
+		Context("when file is created with content", func() {
+			It("should add event after quiet interval", func() {
+				path := filepath.Join(dirPath, "created")
+				Expect(ioutil.WriteFile(path, []byte("data"), 0600)).NotTo(HaveOccurred())
+
+				settler.In <- fsnotify.Event{Name: path, Op: fsnotify.Create}
+
+				Consistently(settler.Out, quiet/2).ShouldNot(Receive())
+				Eventually(settler.Out, 4*quiet).Should(Receive(Equal(fsnotify.Event{Name: path, Op: fsnotify.Write})))
+			})
+		})
+
+		Context("when file is removed", func() {
+			It("should add remove event and drop pending write", func() {
+				path := filepath.Join(dirPath, "removed")
+				event := fsnotify.Event{Name: path, Op: fsnotify.Remove}
+
+				settler.In <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+				settler.In <- event
+
+				Eventually(settler.Out, quiet/2).Should(Receive(Equal(event)))
+				Consistently(settler.Out, 3*quiet).ShouldNot(Receive())
+			})
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package watch
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 
@@ -10,15 +11,19 @@ import (
 )
 
 // Watcher file system notification using event channel.
+// Ops selects file operations added to event channel, only fsnotify.Write is added when Ops is not set.
+// Created files are added only when they are not empty (e.g. renamed into place or rotated), an empty created
+// file is added once it is written.
 type Watcher struct {
 	Watcher   *fsnotify.Watcher
 	EventChan chan fsnotify.Event
+	Ops       fsnotify.Op
 }
 
 // Watch watches new files and directories. Files are added
 // to event channel for processing and directories are
-// added to Watcher for watching new files.
-func (w Watcher) Watch() {
+// added to Watcher for watching new files until ctx is done.
+func (w Watcher) Watch(ctx context.Context) {
 	// The watch does not support listing of added directories.
 	// Check if the directory exists before the watching starts.
 	// This issue should be fixed by developers of Watcher.
@@ -26,6 +31,8 @@ func (w Watcher) Watch() {
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case event, ok := <-w.Watcher.Events:
 			if !ok {
 				logrus.WithField("error", "not ok").Error("watcher is not set correctly")
@@ -48,10 +55,15 @@ func (w Watcher) Watch() {
 						continue
 					}
 					logrus.WithField("dir", event.Name).Debug("dir added to watcher")
+					continue
+				}
+
+				if fi.Size() == 0 && event.Op == fsnotify.Create { // content comes with a write event
+					continue
 				}
 			}
 
-			if event.Op&fsnotify.Write == fsnotify.Write {
+			if event.Op&w.ops() != 0 {
 				w.EventChan <- event // add event to channel when file is modified - writing was done
 			}
 
@@ -65,22 +77,39 @@ func (w Watcher) Watch() {
 	}
 }
 
+func (w Watcher) ops() fsnotify.Op {
+	if w.Ops == 0 {
+		return fsnotify.Write
+	}
+
+	return w.Ops
+}
+
 // AddRootWithSubDirs adds root and subdirectories recursively.
 func (w Watcher) AddRootWithSubDirs(root string) error {
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	return walk(root, func(path string, info os.FileInfo) error {
+		if !info.IsDir() {
+			return nil
+		}
+
+		err := w.Watcher.Add(path)
 		if err != nil {
 			return err
 		}
 
-		if info.IsDir() {
-			err = w.Watcher.Add(path)
-			if err != nil {
-				return err
-			}
+		logrus.WithField("dir", path).Debug("dir added to watcher")
+
+		return nil
+	})
+}
 
-			logrus.WithField("dir", path).Debug("dir added to watcher")
+// walk walks root and its subdirectories and calls fn for every directory and file found.
+func walk(root string, fn func(path string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
 
-		return nil
+		return fn(path, info)
 	})
 }
@@ -1,7 +1,9 @@
 package watch
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -114,7 +116,7 @@ var _ = Describe("Watcher tests", func() {
 			})
 
 			It("should return an error", func(done Done) {
-				go watcher.Watch()
+				go watcher.Watch(context.Background())
 
 				// no detection for this situation
 
@@ -130,7 +132,7 @@ var _ = Describe("Watcher tests", func() {
 			It("should not return an error", func(done Done) {
 				Expect(watcher.AddRootWithSubDirs(dirPath)).NotTo(HaveOccurred())
 
-				go watcher.Watch()
+				go watcher.Watch(context.Background())
 
 				file, err := os.Create(dirPath + "/file.txt")
 				Expect(err).NotTo(HaveOccurred())
@@ -145,5 +147,28 @@ var _ = Describe("Watcher tests", func() {
 				close(done)
 			}, 0.2)
 		})
+
+		Context("when file is renamed into place", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(dirPath, 0700)).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(os.TempDir()+"/watcher-test.txt", []byte("Hello world!"), 0600)).
+					NotTo(HaveOccurred())
+			})
+
+			It("should add created event", func(done Done) {
+				watcher.Ops = fsnotify.Create | fsnotify.Write
+				Expect(watcher.AddRootWithSubDirs(dirPath)).NotTo(HaveOccurred())
+
+				go watcher.Watch(context.Background())
+
+				Expect(os.Rename(os.TempDir()+"/watcher-test.txt", dirPath+"/file.txt")).NotTo(HaveOccurred())
+
+				event := <-watcher.EventChan
+				Expect(event.Op).To(Equal(fsnotify.Create))
+				Expect(event.Name).To(Equal(dirPath + "/file.txt"))
+
+				close(done)
+			}, 0.2)
+		})
 	})
 })